@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"log/slog"
+	"time"
+)
+
+// Acknowledgement of a non-OK result by an operator, a single row of the table acknowledgements.
+// An acknowledged result stays visible, but does not run hooks. The acknowledgement is removed when the
+// result returns to OK, unless it is sticky, and it is ignored after its expire time.
+type Acknowledgement struct {
+	Filename         string        `db:"filename"`
+	Name             string        `db:"name"`
+	Host             string        `db:"host"`
+	Author           string        `db:"author"`
+	Comment          string        `db:"comment"`
+	Sticky           bool          `db:"sticky"`
+	CreatedTimestamp int64         `db:"created_timestamp"`
+	ExpireTimestamp  sql.NullInt64 `db:"expire_timestamp"`
+}
+
+// acknowledgementKey identifies the acknowledged result of a check definition.
+type acknowledgementKey struct {
+	filename string
+	name     string
+	host     string
+}
+
+// acknowledge stores an acknowledgement for a current non-OK result. An existing acknowledgement of the result is replaced.
+func acknowledge(ack Acknowledgement) error {
+	var rc int
+	err := db.Get(&rc, "SELECT rc FROM results WHERE filename = ? AND name = ? AND coalesce(host, '') = ?", ack.Filename, ack.Name, ack.Host)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("result %q von %s nicht gefunden", ack.Name, ack.Filename)
+	}
+	if err != nil {
+		slog.Error("Error selecting result", "err", err)
+		return err
+	}
+	if rc == rcOk {
+		return fmt.Errorf("result %q von %s ist OK und kann nicht acknowledged werden", ack.Name, ack.Filename)
+	}
+
+	_, err = db.Exec(`INSERT INTO acknowledgements (filename, name, host, author, comment, sticky, created_timestamp, expire_timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (filename, name, host) DO UPDATE 
+			SET author = excluded.author, comment = excluded.comment, sticky = excluded.sticky, created_timestamp = excluded.created_timestamp, expire_timestamp = excluded.expire_timestamp`,
+		ack.Filename, ack.Name, ack.Host, ack.Author, ack.Comment, ack.Sticky, time.Now().Unix(), ack.ExpireTimestamp)
+	if err != nil {
+		slog.Error("Error inserting acknowledgement", "err", err)
+		return err
+	}
+	slog.Info("Result acknowledged", "acknowledgement", ack)
+	return nil
+}
+
+// removeAcknowledgement deletes the acknowledgement of a result.
+func removeAcknowledgement(filename string, name string, host string) error {
+	res, err := db.Exec("DELETE FROM acknowledgements WHERE filename = ? AND name = ? AND host = ?", filename, name, host)
+	if err != nil {
+		slog.Error("Error deleting acknowledgement", "err", err)
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("kein acknowledgement für result %q von %s gefunden", name, filename)
+	}
+	return nil
+}
+
+// loadAcknowledgements returns all acknowledgements that are not expired.
+func loadAcknowledgements() (map[acknowledgementKey]Acknowledgement, error) {
+	acks := []Acknowledgement{}
+	err := db.Select(&acks, "SELECT filename, name, host, author, comment, sticky, created_timestamp, expire_timestamp FROM acknowledgements WHERE expire_timestamp IS NULL OR expire_timestamp > ?",
+		time.Now().Unix())
+	if err != nil {
+		slog.Error("Error selecting acknowledgements", "err", err)
+		return nil, err
+	}
+	m := make(map[acknowledgementKey]Acknowledgement, len(acks))
+	for _, ack := range acks {
+		m[acknowledgementKey{ack.Filename, ack.Name, ack.Host}] = ack
+	}
+	return m, nil
+}
+
+// applyAcknowledgements marks the acknowledged results of the check definition filename. Expired acknowledgements
+// and acknowledgements of results that returned to OK, unless they are sticky, are removed.
+func applyAcknowledgements(tx *sqlx.Tx, filename string, results []Result) ([]Result, error) {
+	now := time.Now().Unix()
+	_, err := tx.Exec("DELETE FROM acknowledgements WHERE filename = ? AND expire_timestamp <= ?", filename, now)
+	if err != nil {
+		return nil, err
+	}
+
+	acks := []Acknowledgement{}
+	err = tx.Select(&acks, "SELECT filename, name, host, author, comment, sticky, created_timestamp, expire_timestamp FROM acknowledgements WHERE filename = ?", filename)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[resultKey]Acknowledgement, len(acks))
+	for _, ack := range acks {
+		byKey[resultKey{ack.Name, ack.Host}] = ack
+	}
+
+	for i := range results {
+		result := &results[i]
+		ack, ok := byKey[resultKey{result.Name, result.Host}]
+		if !ok {
+			continue
+		}
+		if result.Rc == rcOk && !ack.Sticky {
+			slog.Info("Result returned to OK - removing acknowledgement", "filename", filename, "name", result.Name, "host", result.Host)
+			_, err = tx.Exec("DELETE FROM acknowledgements WHERE filename = ? AND name = ? AND host = ?", filename, ack.Name, ack.Host)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result.Acknowledged = true
+	}
+	return results, nil
+}
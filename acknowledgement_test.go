@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAcknowledgements(t *testing.T) {
+	makeTestDatabase(t)
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"max_check_attempts": "1"})
+	store := CheckDefinitionFileStore{
+		db:               db,
+		CheckDefinitions: map[string]CheckDefinition{"disk.ini": checkDefinition},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	_, err := ReplaceResults("disk.ini", checkDefinition, parseKamonituOutput("disk.ini", "|2|/var|full||\n|2|/home|full||\n|0|/|ok||\n"))
+	assert.NoError(t, err)
+
+	assert.Error(t, acknowledge(Acknowledgement{Filename: "disk.ini", Name: "/", Author: "test", Comment: "ok"}), "OK results can not be acknowledged")
+	assert.Error(t, acknowledge(Acknowledgement{Filename: "disk.ini", Name: "/tmp", Author: "test", Comment: "unknown"}), "unknown result")
+	assert.NoError(t, acknowledge(Acknowledgement{Filename: "disk.ini", Name: "/var", Author: "test", Comment: "cleanup running"}))
+	assert.NoError(t, acknowledge(Acknowledgement{Filename: "disk.ini", Name: "/home", Author: "test", Comment: "new disk ordered", Sticky: true}))
+
+	acks, err := loadAcknowledgements()
+	assert.NoError(t, err)
+	assert.Len(t, acks, 2)
+	assert.Equal(t, "cleanup running", acks[acknowledgementKey{"disk.ini", "/var", ""}].Comment)
+
+	results, err := ReplaceResults("disk.ini", checkDefinition, parseKamonituOutput("disk.ini", "|2|/var|full||\n|2|/home|full||\n"))
+	assert.NoError(t, err)
+	assert.True(t, results[0].Acknowledged)
+	assert.True(t, results[1].Acknowledged)
+	assert.False(t, hasHardProblemChange(results))
+
+	results, err = ReplaceResults("disk.ini", checkDefinition, parseKamonituOutput("disk.ini", "|0|/var|ok||\n|0|/home|ok||\n"))
+	assert.NoError(t, err)
+	assert.False(t, results[0].Acknowledged, "non sticky acknowledgement is removed on OK")
+	assert.True(t, results[1].Acknowledged, "sticky acknowledgement stays")
+	acks, err = loadAcknowledgements()
+	assert.NoError(t, err)
+	assert.Len(t, acks, 1)
+
+	assert.NoError(t, removeAcknowledgement("disk.ini", "/home", ""))
+	assert.Error(t, removeAcknowledgement("disk.ini", "/home", ""))
+
+	// expired acknowledgements are ignored and removed
+	_, err = ReplaceResults("disk.ini", checkDefinition, parseKamonituOutput("disk.ini", "|2|/var|full||\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, acknowledge(Acknowledgement{Filename: "disk.ini", Name: "/var", Author: "test", Comment: "short",
+		ExpireTimestamp: sql.NullInt64{Int64: time.Now().Add(-time.Second).Unix(), Valid: true}}))
+	acks, err = loadAcknowledgements()
+	assert.NoError(t, err)
+	assert.Empty(t, acks)
+	results, err = ReplaceResults("disk.ini", checkDefinition, parseKamonituOutput("disk.ini", "|2|/var|full||\n"))
+	assert.NoError(t, err)
+	assert.False(t, results[0].Acknowledged)
+}
@@ -18,12 +18,36 @@ type AppConfig struct {
 	LogLevel                           string `db:"log_level" validation:"oneOf(debug,info,warn,error)"`
 	IntervalSecondsBetweenMainLoopRuns int    `db:"interval_seconds_between_main_loop_runs" validation:"within(1,60)"`
 	CheckDefinitionsDir                string `db:"check_definitions_dir" validation:"readableDirectory"`
+	SplaySeconds                       int    `db:"splay_seconds" validation:"within(0,3600)"`
+	MaxParallelChecks                  int    `db:"max_parallel_checks" validation:"within(1,64)"`
+	RunAsUser                          string `db:"run_as_user"`
+	RunAsGroup                         string `db:"run_as_group"`
+	ShutdownGraceSeconds               int    `db:"shutdown_grace_seconds" validation:"within(0,600)"`
+	StateChangesRetentionDays          int    `db:"state_changes_retention_days" validation:"within(1,3650)"`
+	// thresholds of the self monitoring
+	SchedulerLagWarningSeconds  int `db:"scheduler_lag_warning_seconds" validation:"within(1,86400)"`
+	SchedulerLagCriticalSeconds int `db:"scheduler_lag_critical_seconds" validation:"within(1,86400)"`
+	SuspendedChecksWarning      int `db:"suspended_checks_warning" validation:"within(1,10000)"`
+	SuspendedChecksCritical     int `db:"suspended_checks_critical" validation:"within(1,10000)"`
+	DbSizeWarningMb             int `db:"db_size_warning_mb" validation:"within(1,1048576)"`
+	DbSizeCriticalMb            int `db:"db_size_critical_mb" validation:"within(1,1048576)"`
+	WalSizeWarningMb            int `db:"wal_size_warning_mb" validation:"within(1,1048576)"`
+	WalSizeCriticalMb           int `db:"wal_size_critical_mb" validation:"within(1,1048576)"`
+	ReloadFailedWarningSeconds  int `db:"reload_failed_warning_seconds" validation:"within(0,604800)"`
+	ReloadFailedCriticalSeconds int `db:"reload_failed_critical_seconds" validation:"within(0,604800)"`
+	LogDirFreeWarningPercent    int `db:"log_dir_free_warning_percent" validation:"within(0,100)"`
+	LogDirFreeCriticalPercent   int `db:"log_dir_free_critical_percent" validation:"within(0,100)"`
 }
 
 func (c *AppConfig) DbFile() string {
 	return c.VarDir + "/kamonitu.db"
 }
 
+// LockFile is locked by the running daemon and contains its PID.
+func (c *AppConfig) LockFile() string {
+	return c.VarDir + "/kamonitu.pid"
+}
+
 var AppConfigFilePath string
 
 var appConfigDefaultMap = map[string]string{
@@ -33,6 +57,24 @@ var appConfigDefaultMap = map[string]string{
 	"log_level":  "warn",
 	"interval_seconds_between_main_loop_runs": "60",
 	"check_definitions_dir":                   "/etc/kamonitu/check_definitions",
+	"splay_seconds":                           "0",
+	"max_parallel_checks":                     "4",
+	"run_as_user":                             "",
+	"run_as_group":                            "",
+	"shutdown_grace_seconds":                  "30",
+	"state_changes_retention_days":            "90",
+	"scheduler_lag_warning_seconds":           "120",
+	"scheduler_lag_critical_seconds":          "600",
+	"suspended_checks_warning":                "1",
+	"suspended_checks_critical":               "5",
+	"db_size_warning_mb":                      "1024",
+	"db_size_critical_mb":                     "4096",
+	"wal_size_warning_mb":                     "64",
+	"wal_size_critical_mb":                    "256",
+	"reload_failed_warning_seconds":           "0",
+	"reload_failed_critical_seconds":          "3600",
+	"log_dir_free_warning_percent":            "10",
+	"log_dir_free_critical_percent":           "5",
 }
 var appConfigMap = make(map[string]string, len(appConfigDefaultMap))
 
@@ -43,6 +85,24 @@ var appConfigSourceMap = map[string]string{
 	"log_level":  "hardcoded",
 	"interval_seconds_between_main_loop_runs": "hardcoded",
 	"check_definitions_dir":                   "hardcoded",
+	"splay_seconds":                           "hardcoded",
+	"max_parallel_checks":                     "hardcoded",
+	"run_as_user":                             "hardcoded",
+	"run_as_group":                            "hardcoded",
+	"shutdown_grace_seconds":                  "hardcoded",
+	"state_changes_retention_days":            "hardcoded",
+	"scheduler_lag_warning_seconds":           "hardcoded",
+	"scheduler_lag_critical_seconds":          "hardcoded",
+	"suspended_checks_warning":                "hardcoded",
+	"suspended_checks_critical":               "hardcoded",
+	"db_size_warning_mb":                      "hardcoded",
+	"db_size_critical_mb":                     "hardcoded",
+	"wal_size_warning_mb":                     "hardcoded",
+	"wal_size_critical_mb":                    "hardcoded",
+	"reload_failed_warning_seconds":           "hardcoded",
+	"reload_failed_critical_seconds":          "hardcoded",
+	"log_dir_free_warning_percent":            "hardcoded",
+	"log_dir_free_critical_percent":           "hardcoded",
 }
 
 func makeAppConfig(path string) (*AppConfig, error) {
@@ -75,6 +135,9 @@ func makeAppConfig(path string) (*AppConfig, error) {
 	if err = ValidateStruct(appconfig); err != nil {
 		return nil, err
 	}
+	if err = validateSelfMonitoringThresholds(appconfig); err != nil {
+		return nil, err
+	}
 
 	return appconfig, nil
 }
@@ -7,17 +7,38 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 const (
 	checkDefinitionDefaultsFileName = "check_defaults.ini"
+	// kamonituInternalFilename is the filename of the pseudo check definition used for kamonitu internal results
+	kamonituInternalFilename = "kamonitu"
+	// environmentKeyPrefix is the prefix of check definition keys that set environment variables, e.g. env.LANG = C
+	environmentKeyPrefix = "env."
 )
 
+var environmentNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 var hardCodedcheckDefinitionDefaultsMap = map[string]string{
 	"interval_seconds_between_checks":        "120",
 	"delay_seconds_before_first_check":       "0",
 	"timeout_seconds":                        "60",
 	"stop_checking_after_number_of_timeouts": "3",
+	"output_format":                          "auto",
+	"hook_timeout_seconds":                   "30",
+	"max_check_attempts":                     "3",
+	"retry_interval_seconds":                 "30",
+	"flap_detection_window":                  "21",
+	"flap_high_threshold":                    "50",
+	"flap_low_threshold":                     "25",
+	"shell":                                  "true",
+	"max_memory_mb":                          "0",
+	"max_cpu_seconds":                        "0",
+	"max_output_bytes":                       "1048576",
 }
 var checkDefinitionsDefaultMapFromFile map[string]string
 var checkDefinitionDefaultsMap map[string]string
@@ -27,6 +48,17 @@ var checkDefinitionDefaultsSourceMap = map[string]string{
 	"delay_seconds_before_first_check":       "hardcoded",
 	"timeout_seconds":                        "hardcoded",
 	"stop_checking_after_number_of_timeouts": "hardcoded",
+	"output_format":                          "hardcoded",
+	"hook_timeout_seconds":                   "hardcoded",
+	"max_check_attempts":                     "hardcoded",
+	"retry_interval_seconds":                 "hardcoded",
+	"flap_detection_window":                  "hardcoded",
+	"flap_high_threshold":                    "hardcoded",
+	"flap_low_threshold":                     "hardcoded",
+	"shell":                                  "hardcoded",
+	"max_memory_mb":                          "hardcoded",
+	"max_cpu_seconds":                        "hardcoded",
+	"max_output_bytes":                       "hardcoded",
 }
 
 type CheckDefinition struct {
@@ -37,13 +69,42 @@ type CheckDefinition struct {
 	DelaySecondsBeforeFirstCheck      int    `db:"delay_seconds_before_first_check" validation:"within(0,600)"`
 	TimeoutSeconds                    int    `db:"timeout_seconds" validation:"within(1,120)"`
 	StopCheckingAfterNumberOfTimeouts int    `db:"stop_checking_after_number_of_timeouts" validation:"within(1,10)"`
+	OutputFormat                      string `db:"output_format" validation:"oneOf(nagios,kamonitu,auto)"`
+	HookTimeoutSeconds                int    `db:"hook_timeout_seconds" validation:"within(1,120)"`
+	MaxCheckAttempts                  int    `db:"max_check_attempts" validation:"within(1,10)"`
+	RetryIntervalSeconds              int    `db:"retry_interval_seconds" validation:"within(5,3600)"`
+	FlapDetectionWindow               int    `db:"flap_detection_window" validation:"within(3,50)"`
+	FlapHighThreshold                 int    `db:"flap_high_threshold" validation:"within(1,100)"`
+	FlapLowThreshold                  int    `db:"flap_low_threshold" validation:"within(0,100)"`
+	Schedule                          string `db:"schedule" validation:"cronExpression"`
+	CheckPeriod                       string `db:"check_period"`
+	WorkingDirectory                  string `db:"working_directory" validation:"existingDirectory"`
+	Shell                             string `db:"shell" validation:"oneOf(true,false)"`
+	RunAsUser                         string `db:"run_as_user"`
+	RunAsGroup                        string `db:"run_as_group"`
+	MaxMemoryMb                       int    `db:"max_memory_mb" validation:"within(0,65536)"`
+	MaxCpuSeconds                     int    `db:"max_cpu_seconds" validation:"within(0,3600)"`
+	MaxOutputBytes                    int    `db:"max_output_bytes" validation:"within(1024,104857600)"`
+	// Environment are the env.<NAME> keys of the check definition, added to the environment of the check command
+	Environment map[string]string `db:"-" ini:"not_allowed"`
+}
+
+// checkDefinitionRow is a CheckDefinition together with its filename, as stored in the table check_definitions.
+type checkDefinitionRow struct {
+	Filename string `db:"filename"`
+	CheckDefinition
 }
 
 type CheckDefinitionFileStore struct {
 	directory              string
 	CheckDefinitions       map[string]CheckDefinition
 	CheckDefinitionSources map[string]map[string]string
+	TimePeriods            map[string]*TimePeriod
 	db                     *sqlx.DB
+	// lastSuccessfulLoad is the time the check definitions were last loaded without errors. failingSince is
+	// the time of the first load with errors after it, zero if the last load had no errors.
+	lastSuccessfulLoad time.Time
+	failingSince       time.Time
 }
 
 // LoadCheckDefinitionDefaults loads default check definition settings from a specified INI file and updates the current configuration.
@@ -88,6 +149,13 @@ func loadSingleCheckDefinitionFromFile(path string) (checkDefinitionContent *Che
 		return nil, nil, err
 	}
 
+	// schedule ersetzt interval_seconds_between_checks, beide in einer Check Definition sind widersprüchlich
+	if _, ok := iniFileMap["schedule"]; ok {
+		if _, ok := iniFileMap["interval_seconds_between_checks"]; ok {
+			return nil, nil, fmt.Errorf("schedule und interval_seconds_between_checks schließen sich gegenseitig aus")
+		}
+	}
+
 	/**** Merken der Sourcen für Ausgabe von show-config ****/
 	// checkDefinitionDefaultsSourceMap hat bereits Hardcoded und default.ini file korrekt gesetzt
 	sources = make(map[string]string, 10)
@@ -108,11 +176,24 @@ func loadSingleCheckDefinitionFromFile(path string) (checkDefinitionContent *Che
 	}
 	slog.Info("Parsed ini file.", "path", path, "iniFileMap", iniFileMap)
 
+	// env.<NAME> Keys sind nicht im Struct, sie werden als Environment gesammelt
+	environment := make(map[string]string)
+	for key, value := range iniFileMap {
+		if name, ok := strings.CutPrefix(key, environmentKeyPrefix); ok {
+			if !environmentNameRegex.MatchString(name) {
+				return nil, nil, fmt.Errorf("ungültiger Name der Umgebungsvariable in %q", key)
+			}
+			environment[name] = value
+			delete(iniFileMap, key)
+		}
+	}
+
 	checkDefinitionContent, err = ParseStringMapToStruct(iniFileMap, CheckDefinition{})
 	if err != nil {
 		slog.Error("Could not parse ini file to Struct", "file", path, "err", err)
 		return nil, nil, err
 	}
+	checkDefinitionContent.Environment = environment
 
 	err = ValidateStruct(checkDefinitionContent)
 	if err != nil {
@@ -120,11 +201,30 @@ func loadSingleCheckDefinitionFromFile(path string) (checkDefinitionContent *Che
 		return nil, nil, err
 
 	}
+	err = validateCheckDefinition(checkDefinitionContent)
+	if err != nil {
+		slog.Error("error validating check definition", "file", path, "err", err)
+		return nil, nil, err
+	}
 	slog.Info("Parsed ini file.", "file", path, "content", checkDefinitionContent)
 
 	return checkDefinitionContent, sources, nil
 }
 
+// validateCheckDefinition validates rules that span multiple fields and can not be expressed by the validation tag.
+func validateCheckDefinition(checkDefinition *CheckDefinition) error {
+	if checkDefinition.FlapLowThreshold >= checkDefinition.FlapHighThreshold {
+		return fmt.Errorf("field FlapLowThreshold %v muss kleiner als FlapHighThreshold %v sein", checkDefinition.FlapLowThreshold, checkDefinition.FlapHighThreshold)
+	}
+	if checkDefinition.Shell == "false" {
+		_, err := splitCommandLine(checkDefinition.CheckCommand)
+		if err != nil {
+			return fmt.Errorf("field CheckCommand kann nicht in Argumente zerlegt werden: %v", err)
+		}
+	}
+	return nil
+}
+
 // LoadCheckDefinitionsFromDisk loads check definitions from .ini files in the directory and parses their contents into structs.
 // Fills the slice checkDefinitions
 func (c *CheckDefinitionFileStore) LoadCheckDefinitionsFromDisk() error {
@@ -160,6 +260,13 @@ func (c *CheckDefinitionFileStore) LoadCheckDefinitionsFromDisk() error {
 			continue
 		}
 
+		if checkDefinition.CheckPeriod != "" && c.TimePeriods[checkDefinition.CheckPeriod] == nil {
+			myerr := fmt.Errorf("check definition file %q: check_period %q ist nicht in %s definiert", path, checkDefinition.CheckPeriod, timePeriodsFileName)
+			slog.Error(myerr.Error())
+			errors = multierror.Append(errors, myerr)
+			continue
+		}
+
 		c.CheckDefinitionSources[file.Name()] = sources
 		c.CheckDefinitions[file.Name()] = *checkDefinition
 
@@ -168,6 +275,16 @@ func (c *CheckDefinitionFileStore) LoadCheckDefinitionsFromDisk() error {
 	return errors.ErrorOrNil()
 }
 
+// checkDefinitionFilename returns the filename of a check definition given on the command line,
+// which may be a path and may omit the .ini extension, e.g. "swap" for "swap.ini".
+func checkDefinitionFilename(arg string) string {
+	filename := filepath.Base(arg)
+	if !isIniFile(filename) {
+		filename += ".ini"
+	}
+	return filename
+}
+
 // makeCheckDefinitionFileStore initializes and returns a CheckDefinitionFileStore with defaults loaded from a file or hardcoded values.
 func makeCheckDefinitionFileStore(config AppConfig) (*CheckDefinitionFileStore, error) {
 	slog.Info("make CheckDefinitionFileStore")
@@ -179,6 +296,17 @@ func makeCheckDefinitionFileStore(config AppConfig) (*CheckDefinitionFileStore,
 	if err != nil {
 		return nil, err
 	}
+	// run_as_user und run_as_group aus kamonitu.ini gelten als Default für alle Check Definitionen
+	for key, value := range map[string]string{"run_as_user": config.RunAsUser, "run_as_group": config.RunAsGroup} {
+		if value != "" {
+			checkDefinitionDefaultsMap[key] = value
+			checkDefinitionDefaultsSourceMap[key] = "kamonitu.ini"
+		}
+	}
+	err = store.LoadTimePeriods(config.ConfigDir + "/" + timePeriodsFileName)
+	if err != nil {
+		return nil, err
+	}
 	slog.Info("Return new CheckDefinitionFileStore")
 	return &store, nil
 }
@@ -187,7 +315,7 @@ func (c *CheckDefinitionFileStore) ensureCheckDefinitionsInDatabase() error {
 	/*
 	 * Remove CheckDefinitions that no longer exist
 	 */
-	filenames := getKeys(c.CheckDefinitions)
+	filenames := append(getKeys(c.CheckDefinitions), kamonituInternalFilename)
 	slog.Info("Remove CheckDefinitions that no longer exist", "filenames", filenames)
 	query, args, err := sqlx.In("delete from check_definitions where filename not in (?);", filenames)
 	if err != nil {
@@ -196,32 +324,18 @@ func (c *CheckDefinitionFileStore) ensureCheckDefinitionsInDatabase() error {
 	}
 	// sqlx.In returns queries with the `?` bindvar, we can rebind it for our backend
 	query = c.db.Rebind(query)
-	rows, err := c.db.Query(query, args...)
+	_, err = c.db.Exec(query, args...)
 	if err != nil {
 		slog.Error("Error executing query 'delete from chech_definitions where filename not in (?)'", "query", query, "args", args, "err", err)
 		return err
 	}
-	rows.Close()
 
 	/*
 	 * Upsert existing CheckDefinitions
 	 */
 	for filename, cd := range c.CheckDefinitions {
-		sql := `insert into 
-    				check_definitions(filename, check_command, execute_on_failure, execute_on_timeout, interval_seconds_between_checks, delay_seconds_before_first_check, timeout_seconds, stop_checking_after_number_of_timeouts) 
-					values(?,?,?,?,?,?,?,?)
-				on conflict(filename) do 
-					update 
-					    set check_command=?, 
-					    execute_on_failure=?,
-					    execute_on_timeout=?,
-					    interval_seconds_between_checks=?, 
-					    delay_seconds_before_first_check=?, 
-					    timeout_seconds=?, 
-					    stop_checking_after_number_of_timeouts=?`
-		_, err := c.db.Exec(sql, filename, cd.CheckCommand, cd.ExecuteOnFailure, cd.ExecuteOnTimeout, cd.IntervalSecondsBetweenChecks, cd.DelaySecondsBeforeFirstCheck, cd.TimeoutSeconds, cd.StopCheckingAfterNumberOfTimeouts, cd.CheckCommand, cd.ExecuteOnFailure, cd.ExecuteOnTimeout, cd.IntervalSecondsBetweenChecks, cd.DelaySecondsBeforeFirstCheck, cd.TimeoutSeconds, cd.StopCheckingAfterNumberOfTimeouts)
+		err := c.upsertCheckDefinition(filename, cd)
 		if err != nil {
-			slog.Error("Error executing query 'insert into check_definitions'", "sql", sql, "err", err)
 			return err
 		}
 	}
@@ -230,16 +344,124 @@ func (c *CheckDefinitionFileStore) ensureCheckDefinitionsInDatabase() error {
 	return nil
 }
 
-//func (c *CheckDefinitionFileStore) checkDefinitionsToRun() []CheckDefinition {
-//	checkDefinitionsToRun = []CheckDefinition{}
-//	filenames := []string{}
-//	err := c.db.Select(&filenames, "select filename from check_definitions where unixepoch() - interval_seconds_between_checks >= last_run_timestamp order by filename")
-//	if err != nil {
-//		slog.Error("Error executing query 'select filename from check_definitions where unixepoch() - interval_seconds_between_checks >= last_run_timestamp order by filename'", "err", err)
-//	}
-//	for filename := range filenames {
-//		ch
-//	}
-//
-//	return checkDefinitionsToRun
-//}
+// upsertCheckDefinition inserts the check definition into the table check_definitions or updates the existing row.
+func (c *CheckDefinitionFileStore) upsertCheckDefinition(filename string, cd CheckDefinition) error {
+	sql := `insert into 
+    				check_definitions(filename, check_command, execute_on_failure, execute_on_timeout, interval_seconds_between_checks, delay_seconds_before_first_check, timeout_seconds, stop_checking_after_number_of_timeouts, output_format, hook_timeout_seconds, max_check_attempts, retry_interval_seconds, flap_detection_window, flap_high_threshold, flap_low_threshold, schedule, check_period, working_directory, shell, run_as_user, run_as_group, max_memory_mb, max_cpu_seconds, max_output_bytes) 
+				values(:filename, :check_command, :execute_on_failure, :execute_on_timeout, :interval_seconds_between_checks, :delay_seconds_before_first_check, :timeout_seconds, :stop_checking_after_number_of_timeouts, :output_format, :hook_timeout_seconds, :max_check_attempts, :retry_interval_seconds, :flap_detection_window, :flap_high_threshold, :flap_low_threshold, :schedule, :check_period, :working_directory, :shell, :run_as_user, :run_as_group, :max_memory_mb, :max_cpu_seconds, :max_output_bytes)
+			on conflict(filename) do 
+				update 
+				    set check_command=excluded.check_command, 
+				    execute_on_failure=excluded.execute_on_failure,
+				    execute_on_timeout=excluded.execute_on_timeout,
+				    interval_seconds_between_checks=excluded.interval_seconds_between_checks, 
+				    delay_seconds_before_first_check=excluded.delay_seconds_before_first_check, 
+				    timeout_seconds=excluded.timeout_seconds, 
+				    stop_checking_after_number_of_timeouts=excluded.stop_checking_after_number_of_timeouts,
+				    output_format=excluded.output_format,
+				    hook_timeout_seconds=excluded.hook_timeout_seconds,
+				    max_check_attempts=excluded.max_check_attempts,
+				    retry_interval_seconds=excluded.retry_interval_seconds,
+				    flap_detection_window=excluded.flap_detection_window,
+				    flap_high_threshold=excluded.flap_high_threshold,
+				    flap_low_threshold=excluded.flap_low_threshold,
+				    schedule=excluded.schedule,
+				    check_period=excluded.check_period,
+				    working_directory=excluded.working_directory,
+				    shell=excluded.shell,
+				    run_as_user=excluded.run_as_user,
+				    run_as_group=excluded.run_as_group,
+				    max_memory_mb=excluded.max_memory_mb,
+				    max_cpu_seconds=excluded.max_cpu_seconds,
+				    max_output_bytes=excluded.max_output_bytes`
+	_, err := c.db.NamedExec(sql, checkDefinitionRow{Filename: filename, CheckDefinition: cd})
+	if err != nil {
+		slog.Error("Error executing query 'insert into check_definitions'", "sql", sql, "err", err)
+		return err
+	}
+	return nil
+}
+
+// dueCheck is a check definition that is due to run since DueTimestamp.
+type dueCheck struct {
+	Filename     string `db:"filename"`
+	DueTimestamp int64  `db:"due_timestamp"`
+}
+
+// checkDefinitionSchedule is the scheduling state of a check definition in the table check_definitions.
+type checkDefinitionSchedule struct {
+	Filename             string `db:"filename"`
+	LastRunTimestamp     int64  `db:"last_run_timestamp"`
+	IntervalDueTimestamp int64  `db:"interval_due_timestamp"`
+	Schedule             string `db:"schedule"`
+	SoftState            bool   `db:"soft_state"`
+}
+
+// dueTimestamp returns the time the check definition is due to run. Checks with a schedule are due at the next
+// time of the cron expression after their last run, all other checks interval_seconds_between_checks after their last run.
+// Checks with results in a SOFT state are rechecked after retry_interval_seconds. Checks that never ran are due immediately,
+// checks with a schedule that never ran at the next time of the cron expression after startedAt of the daemon.
+func (c checkDefinitionSchedule) dueTimestamp(startedAt time.Time) (int64, error) {
+	if c.Schedule == "" || c.SoftState {
+		return c.IntervalDueTimestamp, nil
+	}
+	lastRun := time.Unix(c.LastRunTimestamp, 0)
+	if c.LastRunTimestamp == 0 {
+		lastRun = startedAt
+	}
+	schedule, err := parseCronExpression(c.Schedule)
+	if err != nil {
+		return 0, err
+	}
+	next := schedule.next(lastRun)
+	if next.IsZero() {
+		return 0, fmt.Errorf("cron expression %q trifft nie zu", c.Schedule)
+	}
+	return next.Unix(), nil
+}
+
+// checkDefinitionsToRun returns all check definitions that are due to run, the most overdue first,
+// based on interval_seconds_between_checks or schedule and last_run_timestamp in the database. Suspended checks are skipped.
+// startedAt is the start of the daemon, checks with a schedule that never ran are due at the next time of their schedule after it.
+func (c *CheckDefinitionFileStore) checkDefinitionsToRun(startedAt time.Time) ([]dueCheck, error) {
+	schedules := []checkDefinitionSchedule{}
+	sql := `select filename, last_run_timestamp, schedule, soft_state,
+				last_run_timestamp + (case when soft_state = 1 then retry_interval_seconds else interval_seconds_between_checks end) as interval_due_timestamp 
+			from check_definitions 
+			where filename != ? and suspended = 0`
+	err := c.db.Select(&schedules, sql, kamonituInternalFilename)
+	if err != nil {
+		slog.Error("Error executing query 'select filename from check_definitions'", "sql", sql, "err", err)
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	dueChecks := []dueCheck{}
+	for _, schedule := range schedules {
+		due, err := schedule.dueTimestamp(startedAt)
+		if err != nil {
+			slog.Error("Error computing due timestamp", "filename", schedule.Filename, "err", err)
+			continue
+		}
+		if now >= due {
+			dueChecks = append(dueChecks, dueCheck{Filename: schedule.Filename, DueTimestamp: due})
+		}
+	}
+	sort.Slice(dueChecks, func(i, j int) bool {
+		if dueChecks[i].DueTimestamp != dueChecks[j].DueTimestamp {
+			return dueChecks[i].DueTimestamp < dueChecks[j].DueTimestamp
+		}
+		return dueChecks[i].Filename < dueChecks[j].Filename
+	})
+	return dueChecks, nil
+}
+
+// updateLastRunTimestamp sets last_run_timestamp of the check definition, so the schedule survives restarts.
+func (c *CheckDefinitionFileStore) updateLastRunTimestamp(filename string, timestamp time.Time) error {
+	_, err := c.db.Exec("update check_definitions set last_run_timestamp = ? where filename = ?", timestamp.Unix(), filename)
+	if err != nil {
+		slog.Error("Error updating last_run_timestamp", "filename", filename, "err", err)
+		return err
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestMakeCheckDefinitionFileStore(t *testing.T) {
@@ -80,4 +81,162 @@ func TestMakeCheckDefinitionFileStore(t *testing.T) {
 	assert.NoError(t, err)
 	err = store.LoadCheckDefinitionsFromDisk()
 	assert.Error(t, err)
+
+	// schedule and interval_seconds_between_checks are mutually exclusive
+	path := checkdir + "/backup.ini"
+	err = os.WriteFile(path, []byte("check_command = /usr/bin/check_backup\nschedule = 15 6 * * *\n"), 0644)
+	assert.NoError(t, err)
+	checkDefinition, _, err := loadSingleCheckDefinitionFromFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "15 6 * * *", checkDefinition.Schedule)
+	err = os.WriteFile(path, []byte("check_command = /usr/bin/check_backup\nschedule = 15 6 * * *\ninterval_seconds_between_checks = 60\n"), 0644)
+	assert.NoError(t, err)
+	_, _, err = loadSingleCheckDefinitionFromFile(path)
+	assert.Error(t, err)
+	err = os.WriteFile(path, []byte("check_command = /usr/bin/check_backup\nschedule = 15 25 * * *\n"), 0644)
+	assert.NoError(t, err)
+	_, _, err = loadSingleCheckDefinitionFromFile(path)
+	assert.Error(t, err, "invalid cron expression")
+
+	// env.<NAME> keys, working_directory and shell
+	err = os.WriteFile(path, []byte("check_command = /usr/bin/check_backup\nenv.LANG = C\nenv.BACKUP_DIR = /srv/backup\nworking_directory = "+d+"\nshell = false\n"), 0644)
+	assert.NoError(t, err)
+	checkDefinition, sources, err := loadSingleCheckDefinitionFromFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"LANG": "C", "BACKUP_DIR": "/srv/backup"}, checkDefinition.Environment)
+	assert.Equal(t, d, checkDefinition.WorkingDirectory)
+	assert.Equal(t, "false", checkDefinition.Shell)
+	assert.Equal(t, "backup.ini", sources["env.LANG"])
+	for _, content := range []string{
+		"check_command = /usr/bin/check_backup\nenv.1LANG = C\n",
+		"check_command = /usr/bin/check_backup\nworking_directory = " + d + "/nonexistent\n",
+		"check_command = /usr/bin/check_backup\nshell = yes\n",
+		"check_command = /usr/bin/check_backup 'unterminated\nshell = false\n",
+	} {
+		err = os.WriteFile(path, []byte(content), 0644)
+		assert.NoError(t, err)
+		_, _, err = loadSingleCheckDefinitionFromFile(path)
+		assert.Error(t, err, content)
+	}
+}
+
+// makeTestDatabase migrates a fresh database in a temporary directory and connects the global db to it.
+func makeTestDatabase(t *testing.T) string {
+	dbFile := t.TempDir() + "/kamonitu.db"
+	err := migrateDatabase(dbFile)
+	assert.NoError(t, err)
+	_, err = initDB(dbFile)
+	assert.NoError(t, err)
+	t.Cleanup(closeDB)
+	return dbFile
+}
+
+// makeTestCheckDefinition returns a CheckDefinition with the hardcoded defaults, overwritten by values.
+func makeTestCheckDefinition(t *testing.T, values map[string]string) CheckDefinition {
+	iniMap := map[string]string{"check_command": "true"}
+	for key, value := range hardCodedcheckDefinitionDefaultsMap {
+		iniMap[key] = value
+	}
+	for key, value := range values {
+		iniMap[key] = value
+	}
+	checkDefinition, err := ParseStringMapToStruct(iniMap, CheckDefinition{})
+	assert.NoError(t, err)
+	return *checkDefinition
+}
+
+func TestCheckDefinitionsToRun(t *testing.T) {
+	makeTestDatabase(t)
+	store := CheckDefinitionFileStore{
+		db: db,
+		CheckDefinitions: map[string]CheckDefinition{
+			"swap.ini": makeTestCheckDefinition(t, map[string]string{"interval_seconds_between_checks": "60"}),
+			"cpu.ini":  makeTestCheckDefinition(t, map[string]string{"interval_seconds_between_checks": "60"}),
+		},
+	}
+	err := store.ensureCheckDefinitionsInDatabase()
+	assert.NoError(t, err)
+
+	dueChecks, err := store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []dueCheck{{Filename: "cpu.ini", DueTimestamp: 60}, {Filename: "swap.ini", DueTimestamp: 60}}, dueChecks)
+
+	lastRun := time.Now().Add(-61 * time.Second)
+	err = store.updateLastRunTimestamp("cpu.ini", time.Now())
+	assert.NoError(t, err)
+	err = store.updateLastRunTimestamp("swap.ini", lastRun)
+	assert.NoError(t, err)
+	dueChecks, err = store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []dueCheck{{Filename: "swap.ini", DueTimestamp: lastRun.Unix() + 60}}, dueChecks)
+
+	// checks with a schedule that never ran are due at the next time of the cron expression after the daemon start
+	store.CheckDefinitions["backup.ini"] = makeTestCheckDefinition(t, map[string]string{"schedule": "15 6 * * *"})
+	err = store.ensureCheckDefinitionsInDatabase()
+	assert.NoError(t, err)
+	schedule, err := parseCronExpression("15 6 * * *")
+	assert.NoError(t, err)
+	dueChecks, err = store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []dueCheck{{Filename: "swap.ini", DueTimestamp: lastRun.Unix() + 60}}, dueChecks)
+	startedAt := time.Now().Add(-25 * time.Hour)
+	dueChecks, err = store.checkDefinitionsToRun(startedAt)
+	assert.NoError(t, err)
+	assert.Equal(t, []dueCheck{{Filename: "backup.ini", DueTimestamp: schedule.next(startedAt).Unix()}, {Filename: "swap.ini", DueTimestamp: lastRun.Unix() + 60}}, dueChecks)
+
+	// checks with a schedule are due at the next time of the cron expression after their last run
+	lastBackupRun := time.Now().Add(-25 * time.Hour)
+	err = store.updateLastRunTimestamp("backup.ini", lastBackupRun)
+	assert.NoError(t, err)
+	dueChecks, err = store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []dueCheck{{Filename: "backup.ini", DueTimestamp: schedule.next(lastBackupRun).Unix()}, {Filename: "swap.ini", DueTimestamp: lastRun.Unix() + 60}}, dueChecks)
+	err = store.updateLastRunTimestamp("backup.ini", time.Now())
+	assert.NoError(t, err)
+	dueChecks, err = store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []dueCheck{{Filename: "swap.ini", DueTimestamp: lastRun.Unix() + 60}}, dueChecks)
+
+	// kamonitu internal results reference the pseudo check definition
+	err = ReplaceKamonituResults([]string{"some error"}, "test")
+	assert.NoError(t, err)
+}
+
+func TestSuspendCheckAfterTimeouts(t *testing.T) {
+	makeTestDatabase(t)
+	store := CheckDefinitionFileStore{
+		db: db,
+		CheckDefinitions: map[string]CheckDefinition{
+			"swap.ini": makeTestCheckDefinition(t, nil),
+		},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	countSuspendedResults := func() int {
+		var count int
+		assert.NoError(t, db.Get(&count, "select count(*) from results where tags = ?", suspendedCheckTag("swap.ini")))
+		return count
+	}
+
+	assert.NoError(t, recordTimeout("swap.ini", 2))
+	assert.NoError(t, resetTimeouts("swap.ini"))
+	assert.NoError(t, recordTimeout("swap.ini", 2))
+	dueChecks, err := store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, dueChecks, 1)
+	assert.Equal(t, 0, countSuspendedResults())
+
+	assert.NoError(t, recordTimeout("swap.ini", 2))
+	dueChecks, err = store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, dueChecks)
+	assert.Equal(t, 1, countSuspendedResults())
+
+	assert.NoError(t, resumeCheck("swap.ini"))
+	dueChecks, err = store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, dueChecks, 1)
+	assert.Equal(t, 0, countSuspendedResults())
+
+	assert.Error(t, resumeCheck("unknown.ini"))
 }
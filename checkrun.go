@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"log/slog"
+)
+
+const (
+	// checkRunOutputMaxBytes is the maximum length of stdout and stderr stored per run
+	checkRunOutputMaxBytes = 64 * 1024
+	// checkRunsKeptPerCheck is the number of runs kept per check definition, older runs are removed
+	checkRunsKeptPerCheck = 100
+)
+
+// CheckRun is a single execution of a check definition, a row of the table check_runs.
+// The results of a check reference the run that produced them.
+type CheckRun struct {
+	Id              int64  `db:"id"`
+	Filename        string `db:"filename"`
+	StartedAt       int64  `db:"started_at"`
+	DurationMs      int64  `db:"duration_ms"`
+	ExitCode        int    `db:"exit_code"`
+	Signal          string `db:"signal"`
+	TimedOut        bool   `db:"timed_out"`
+	Error           string `db:"error"`
+	Stdout          string `db:"stdout"`
+	Stderr          string `db:"stderr"`
+	OutputTruncated bool   `db:"output_truncated"`
+	UserCpuMs       int64  `db:"user_cpu_ms"`
+	SystemCpuMs     int64  `db:"system_cpu_ms"`
+	MaxRssKb        int64  `db:"max_rss_kb"`
+}
+
+// makeCheckRun returns the check run of an execution. Stdout and stderr are truncated to checkRunOutputMaxBytes.
+func makeCheckRun(filename string, execution ExecutionResult) CheckRun {
+	run := CheckRun{
+		Filename:        filename,
+		StartedAt:       execution.StartedAt.Unix(),
+		DurationMs:      execution.Duration.Milliseconds(),
+		ExitCode:        execution.ExitCode,
+		TimedOut:        execution.TimedOut,
+		OutputTruncated: execution.OutputTruncated,
+		UserCpuMs:       execution.ResourceUsage.UserCpu.Milliseconds(),
+		SystemCpuMs:     execution.ResourceUsage.SystemCpu.Milliseconds(),
+		MaxRssKb:        execution.ResourceUsage.MaxRssKb,
+	}
+	if execution.Signal != 0 {
+		run.Signal = unix.SignalName(execution.Signal)
+	}
+	if execution.Err != nil {
+		run.Error = execution.Err.Error()
+	}
+	run.Stdout, run.OutputTruncated = truncateOutput(execution.Stdout, run.OutputTruncated)
+	run.Stderr, run.OutputTruncated = truncateOutput(execution.Stderr, run.OutputTruncated)
+	return run
+}
+
+// truncateOutput cuts output to checkRunOutputMaxBytes. Returns the output and whether it or a previous output was truncated.
+func truncateOutput(output string, truncated bool) (string, bool) {
+	if len(output) <= checkRunOutputMaxBytes {
+		return output, truncated
+	}
+	return output[:checkRunOutputMaxBytes], true
+}
+
+// recordCheckRun stores the run and removes the runs of the check definition beyond checkRunsKeptPerCheck.
+// Returns the id of the run.
+func recordCheckRun(run CheckRun) (int64, error) {
+	res, err := db.NamedExec(`INSERT INTO check_runs (filename, started_at, duration_ms, exit_code, signal, timed_out, error, stdout, stderr, output_truncated, user_cpu_ms, system_cpu_ms, max_rss_kb)
+			VALUES (:filename, :started_at, :duration_ms, :exit_code, :signal, :timed_out, :error, :stdout, :stderr, :output_truncated, :user_cpu_ms, :system_cpu_ms, :max_rss_kb)`, run)
+	if err != nil {
+		slog.Error("Error inserting check run", "filename", run.Filename, "err", err)
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.Exec(`DELETE FROM check_runs WHERE filename = ? AND id <=
+			(SELECT id FROM check_runs WHERE filename = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`, run.Filename, run.Filename, checkRunsKeptPerCheck)
+	if err != nil {
+		slog.Error("Error deleting old check runs", "filename", run.Filename, "err", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// loadCheckRuns returns the latest runs without their output, newest first. filename restricts the runs to a check definition, if not empty.
+func loadCheckRuns(filename string, limit int) ([]CheckRun, error) {
+	query := `SELECT id, filename, started_at, duration_ms, exit_code, signal, timed_out, error, '' as stdout, '' as stderr, output_truncated, user_cpu_ms, system_cpu_ms, max_rss_kb
+			FROM check_runs`
+	args := []any{}
+	if filename != "" {
+		query += " WHERE filename = ?"
+		args = append(args, filename)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	runs := []CheckRun{}
+	err := db.Select(&runs, query, args...)
+	if err != nil {
+		slog.Error("Error selecting check runs", "query", query, "err", err)
+		return nil, err
+	}
+	return runs, nil
+}
+
+// loadCheckRun returns a single run with its output.
+func loadCheckRun(id int64) (*CheckRun, error) {
+	run := CheckRun{}
+	err := db.Get(&run, `SELECT id, filename, started_at, duration_ms, exit_code, signal, timed_out, error, stdout, stderr, output_truncated, user_cpu_ms, system_cpu_ms, max_rss_kb
+			FROM check_runs WHERE id = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("run %d nicht gefunden", id)
+	}
+	if err != nil {
+		slog.Error("Error selecting check run", "id", id, "err", err)
+		return nil, err
+	}
+	return &run, nil
+}
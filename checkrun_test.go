@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMakeCheckRun(t *testing.T) {
+	startedAt := time.Now()
+	execution := ExecutionResult{
+		StartedAt:     startedAt,
+		ExitCode:      -1,
+		Signal:        syscall.SIGKILL,
+		Stdout:        strings.Repeat("x", checkRunOutputMaxBytes+1),
+		Stderr:        "killed\n",
+		Duration:      1500 * time.Millisecond,
+		Err:           errors.New("some error"),
+		ResourceUsage: resourceUsage{UserCpu: time.Second, MaxRssKb: 1024},
+	}
+	run := makeCheckRun("swap.ini", execution)
+	assert.Equal(t, "swap.ini", run.Filename)
+	assert.Equal(t, startedAt.Unix(), run.StartedAt)
+	assert.Equal(t, int64(1500), run.DurationMs)
+	assert.Equal(t, "SIGKILL", run.Signal)
+	assert.Equal(t, "some error", run.Error)
+	assert.Len(t, run.Stdout, checkRunOutputMaxBytes)
+	assert.True(t, run.OutputTruncated)
+	assert.Equal(t, "killed\n", run.Stderr)
+	assert.Equal(t, int64(1000), run.UserCpuMs)
+	assert.Equal(t, int64(1024), run.MaxRssKb)
+
+	run = makeCheckRun("swap.ini", ExecutionResult{StartedAt: startedAt, Stdout: "ok"})
+	assert.Equal(t, "", run.Signal)
+	assert.False(t, run.OutputTruncated)
+}
+
+func TestRecordCheckRun(t *testing.T) {
+	makeTestDatabase(t)
+	checkDefinition := makeTestCheckDefinition(t, nil)
+	store := CheckDefinitionFileStore{
+		db:               db,
+		CheckDefinitions: map[string]CheckDefinition{"swap.ini": checkDefinition, "cpu.ini": checkDefinition},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	var lastId int64
+	for i := 0; i < checkRunsKeptPerCheck+5; i++ {
+		id, err := recordCheckRun(CheckRun{Filename: "swap.ini", StartedAt: time.Now().Unix(), Stdout: "|0|Swap|OK"})
+		assert.NoError(t, err)
+		assert.Greater(t, id, lastId)
+		lastId = id
+	}
+	cpuId, err := recordCheckRun(CheckRun{Filename: "cpu.ini", StartedAt: time.Now().Unix(), ExitCode: 2})
+	assert.NoError(t, err)
+
+	runs, err := loadCheckRuns("swap.ini", 1000)
+	assert.NoError(t, err)
+	assert.Len(t, runs, checkRunsKeptPerCheck, "older runs are removed")
+	assert.Equal(t, lastId, runs[0].Id, "newest first")
+	assert.Equal(t, "", runs[0].Stdout, "the list is loaded without output")
+	runs, err = loadCheckRuns("", 5)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 5)
+	assert.Equal(t, cpuId, runs[0].Id)
+
+	run, err := loadCheckRun(lastId)
+	assert.NoError(t, err)
+	assert.Equal(t, "|0|Swap|OK", run.Stdout)
+	_, err = loadCheckRun(lastId + 1000)
+	assert.Error(t, err)
+
+	// results reference the run that produced them
+	results := parseKamonituOutput("swap.ini", "|0|Swap|OK\n")
+	results[0].RunId.Int64, results[0].RunId.Valid = lastId, true
+	_, err = ReplaceResults("swap.ini", checkDefinition, results)
+	assert.NoError(t, err)
+	stored, err := loadResults()
+	assert.NoError(t, err)
+	assert.Equal(t, lastId, stored[0].RunId.Int64)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit is the maximum time span searched for the next run time of a cron expression
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronMacros are the supported shortcuts for cron expressions
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var cronWeekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// cronField describes the allowed values of a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names for the values starting at min, e.g. jan for 1
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: cronMonthNames},
+	{name: "day of week", min: 0, max: 7, names: cronWeekdayNames},
+}
+
+// cronSchedule is a parsed cron expression. Each field is a bit set of the matching values.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// dayOfMonthStar and dayOfWeekStar are set, if the field is *. If both day fields are restricted,
+	// a day matches if either of them matches, like in cron.
+	dayOfMonthStar, dayOfWeekStar bool
+}
+
+// parseCronExpression parses a cron expression with the five fields minute, hour, day of month, month
+// and day of week, e.g. "15 6 * * *" or "*/10 8-18 * * mon-fri", or one of the macros like @daily.
+func parseCronExpression(expression string) (*cronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if macro, ok := cronMacros[strings.ToLower(expression)]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q muss %d Felder haben, hat aber %d", expression, len(cronFields), len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", expression, err)
+		}
+		bits[i] = b
+	}
+	// 7 is sunday like 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	schedule := &cronSchedule{
+		minute:         bits[0],
+		hour:           bits[1],
+		dayOfMonth:     bits[2],
+		month:          bits[3],
+		dayOfWeek:      bits[4],
+		dayOfMonthStar: fields[2] == "*",
+		dayOfWeekStar:  fields[4] == "*",
+	}
+	if schedule.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q trifft nie zu", expression)
+	}
+	return schedule, nil
+}
+
+// parseCronField parses a comma separated list of *, values and ranges, each with an optional step, e.g. "1-5,*/15".
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("ungültige Schrittweite %q im Feld %s", stepPart, spec.name)
+			}
+		}
+
+		var lower, upper int
+		var err error
+		switch {
+		case rangePart == "*":
+			lower, upper = spec.min, spec.max
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			lower, err = parseCronValue(from, spec)
+			if err != nil {
+				return 0, err
+			}
+			upper, err = parseCronValue(to, spec)
+			if err != nil {
+				return 0, err
+			}
+			if lower > upper {
+				return 0, fmt.Errorf("ungültiger Bereich %q im Feld %s", rangePart, spec.name)
+			}
+		default:
+			lower, err = parseCronValue(rangePart, spec)
+			if err != nil {
+				return 0, err
+			}
+			upper = lower
+			if hasStep {
+				upper = spec.max
+			}
+		}
+
+		for v := lower; v <= upper; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a single number or name of a cron field.
+func parseCronValue(value string, spec cronField) (int, error) {
+	for i, name := range spec.names {
+		if strings.EqualFold(value, name) {
+			return spec.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < spec.min || v > spec.max {
+		return 0, fmt.Errorf("ungültiger Wert %q im Feld %s, erlaubt sind %d bis %d", value, spec.name, spec.min, spec.max)
+	}
+	return v, nil
+}
+
+// next returns the first time after t matching the schedule, in the location of t.
+// Returns the zero time, if there is no match within cronSearchLimit.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	limit := t.Add(cronSearchLimit)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		if c.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches returns true, if the day of t matches the day of month and day of week fields.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dayOfMonth := c.dayOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := c.dayOfWeek&(1<<int(t.Weekday())) != 0
+	if c.dayOfMonthStar || c.dayOfWeekStar {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
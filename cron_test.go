@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCronExpression(t *testing.T) {
+	valid := []string{"15 6 * * *", "*/10 8-18 * * mon-fri", "0 0 1,15 * *", "0 12 * jan-mar 7", "@daily", "@HOURLY", "5-59/15 * * * *"}
+	for _, expression := range valid {
+		_, err := parseCronExpression(expression)
+		assert.NoError(t, err, expression)
+	}
+	invalid := []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "10-5 * * * *", "x * * * *", "@sometimes", "0 0 30 feb *"}
+	for _, expression := range invalid {
+		_, err := parseCronExpression(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	at := func(value string) time.Time {
+		ts, err := time.ParseInLocation(time.DateTime, value, time.Local)
+		assert.NoError(t, err)
+		return ts
+	}
+	tests := []struct {
+		expression string
+		from       string
+		want       string
+	}{
+		{"15 6 * * *", "2025-02-10 06:14:59", "2025-02-10 06:15:00"},
+		{"15 6 * * *", "2025-02-10 06:15:00", "2025-02-11 06:15:00"},
+		{"*/10 8-18 * * mon-fri", "2025-02-07 18:55:00", "2025-02-10 08:00:00"},
+		{"0 0 1,15 * *", "2025-02-02 10:00:00", "2025-02-15 00:00:00"},
+		{"0 12 * * sun", "2025-02-10 00:00:00", "2025-02-16 12:00:00"},
+		{"0 12 * * 7", "2025-02-10 00:00:00", "2025-02-16 12:00:00"},
+		{"0 0 13 * fri", "2025-02-10 00:00:00", "2025-02-13 00:00:00"},
+		{"0 0 29 2 *", "2025-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"@monthly", "2025-12-31 23:59:00", "2026-01-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression+" "+tt.from, func(t *testing.T) {
+			schedule, err := parseCronExpression(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, at(tt.want), schedule.next(at(tt.from)))
+		})
+	}
+}
@@ -10,7 +10,9 @@ import (
 var db *sqlx.DB
 
 const (
-	sqlite_connect_options = "?_foreign_keys=on&_busy_timeout=10000&_journal_mode=wal"
+	// Transactions take the write lock at begin. Deferred transactions that read before they write get SQLITE_BUSY
+	// without waiting for the busy timeout, when another connection writes in between.
+	sqlite_connect_options = "?_foreign_keys=on&_busy_timeout=10000&_journal_mode=wal&_txlock=immediate"
 )
 
 // Initialize the database connection
@@ -27,9 +29,30 @@ func initDB(path string) (*sqlx.DB, error) {
 	return db, nil
 }
 
-// Close the database connection
+// Close the database connection. Closing the last connection checkpoints the WAL into the database file.
 func closeDB() {
 	if db != nil {
-		db.Close()
+		err := db.Close()
+		if err != nil {
+			slog.Error("Error closing database", "err", err)
+			return
+		}
+		slog.Debug("Database closed")
 	}
 }
+
+// openDatabase migrates the database of the AppConfig and connects to it.
+func openDatabase(config *AppConfig) (*sqlx.DB, error) {
+	err := migrateDatabase(config.DbFile())
+	if err != nil {
+		slog.Error("Error running database migrations", "err", err)
+		return nil, err
+	}
+
+	mydb, err := initDB(config.DbFile())
+	if err != nil {
+		slog.Error("Error initializing database", "err", err)
+		return nil, err
+	}
+	return mydb, nil
+}
@@ -0,0 +1,8 @@
+-- migrate:up
+-- Pseudo check definition for kamonitu internal results. results.filename references
+-- check_definitions, so the internal results need a row to point to.
+insert into check_definitions (filename, check_command, interval_seconds_between_checks, delay_seconds_before_first_check, timeout_seconds, stop_checking_after_number_of_timeouts)
+values ('kamonitu', 'internal', 3600, 0, 120, 10);
+
+-- migrate:down
+delete from check_definitions where filename = 'kamonitu';
@@ -0,0 +1,5 @@
+-- migrate:up
+alter table check_definitions add column output_format text not null default 'auto' check (output_format in ('nagios', 'kamonitu', 'auto'));
+
+-- migrate:down
+alter table check_definitions drop column output_format;
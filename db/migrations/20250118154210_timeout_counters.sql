@@ -0,0 +1,7 @@
+-- migrate:up
+alter table check_definitions add column consecutive_timeouts integer not null default 0;
+alter table check_definitions add column suspended integer not null default 0 check (suspended in (0, 1));
+
+-- migrate:down
+alter table check_definitions drop column suspended;
+alter table check_definitions drop column consecutive_timeouts;
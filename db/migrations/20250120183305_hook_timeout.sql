@@ -0,0 +1,5 @@
+-- migrate:up
+alter table check_definitions add column hook_timeout_seconds integer not null default 30 check (hook_timeout_seconds between 1 and 120);
+
+-- migrate:down
+alter table check_definitions drop column hook_timeout_seconds;
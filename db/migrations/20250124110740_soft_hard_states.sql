@@ -0,0 +1,17 @@
+-- migrate:up
+alter table check_definitions add column max_check_attempts integer not null default 3 check (max_check_attempts between 1 and 10);
+alter table check_definitions add column retry_interval_seconds integer not null default 30 check (retry_interval_seconds between 5 and 3600);
+alter table check_definitions add column soft_state integer not null default 0 check (soft_state in (0, 1));
+
+alter table results add column state_type text not null default 'HARD' check (state_type in ('SOFT', 'HARD'));
+alter table results add column attempt integer not null default 1;
+alter table results add column last_hard_rc integer not null default 0;
+
+-- migrate:down
+alter table results drop column last_hard_rc;
+alter table results drop column attempt;
+alter table results drop column state_type;
+
+alter table check_definitions drop column soft_state;
+alter table check_definitions drop column retry_interval_seconds;
+alter table check_definitions drop column max_check_attempts;
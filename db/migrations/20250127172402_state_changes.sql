@@ -0,0 +1,18 @@
+-- migrate:up
+create table state_changes
+(
+    id         integer not null primary key autoincrement,
+    filename   text    not null,
+    name       text    not null,
+    host       text             default null,
+    old_rc     integer          default null,
+    new_rc     integer not null,
+    state_type text    not null,
+    text       text             default null,
+    timestamp  integer not null
+) strict;
+
+create index idx_state_changes_timestamp on state_changes (timestamp);
+
+-- migrate:down
+drop table state_changes;
@@ -0,0 +1,17 @@
+-- migrate:up
+alter table check_definitions add column flap_detection_window integer not null default 21 check (flap_detection_window between 3 and 50);
+alter table check_definitions add column flap_high_threshold integer not null default 50 check (flap_high_threshold between 1 and 100);
+alter table check_definitions add column flap_low_threshold integer not null default 25 check (flap_low_threshold between 0 and 100);
+
+alter table results add column state_history text not null default '';
+alter table results add column percent_state_change integer not null default 0;
+alter table results add column flapping integer not null default 0 check (flapping in (0, 1));
+
+-- migrate:down
+alter table results drop column flapping;
+alter table results drop column percent_state_change;
+alter table results drop column state_history;
+
+alter table check_definitions drop column flap_low_threshold;
+alter table check_definitions drop column flap_high_threshold;
+alter table check_definitions drop column flap_detection_window;
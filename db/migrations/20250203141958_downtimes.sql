@@ -0,0 +1,24 @@
+-- migrate:up
+create table downtimes
+(
+    id                integer not null primary key autoincrement,
+    filename          text             default null,
+    name_pattern      text             default null,
+    host              text             default null,
+    tag               text             default null,
+    start_timestamp   integer not null,
+    end_timestamp     integer not null,
+    author            text    not null,
+    comment           text             default null,
+    created_timestamp integer not null,
+    check (end_timestamp > start_timestamp),
+    check (coalesce(filename, name_pattern, host, tag) is not null)
+) strict;
+
+create index idx_downtimes_end_timestamp on downtimes (end_timestamp);
+
+alter table results add column in_downtime integer not null default 0 check (in_downtime in (0, 1));
+
+-- migrate:down
+alter table results drop column in_downtime;
+drop table downtimes;
@@ -0,0 +1,18 @@
+-- migrate:up
+create table acknowledgements
+(
+    id                integer not null primary key autoincrement,
+    filename          text    not null,
+    name              text    not null,
+    host              text    not null default '',
+    author            text    not null,
+    comment           text    not null,
+    sticky            integer not null default 0 check (sticky in (0, 1)),
+    created_timestamp integer not null,
+    expire_timestamp  integer          default null,
+    unique (filename, name, host),
+    foreign key (filename) references check_definitions (filename) on delete cascade on update cascade
+) strict;
+
+-- migrate:down
+drop table acknowledgements;
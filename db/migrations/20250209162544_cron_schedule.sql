@@ -0,0 +1,5 @@
+-- migrate:up
+alter table check_definitions add column schedule text not null default '';
+
+-- migrate:down
+alter table check_definitions drop column schedule;
@@ -0,0 +1,7 @@
+-- migrate:up
+alter table check_definitions add column working_directory text not null default '';
+alter table check_definitions add column shell text not null default 'true' check (shell in ('true', 'false'));
+
+-- migrate:down
+alter table check_definitions drop column shell;
+alter table check_definitions drop column working_directory;
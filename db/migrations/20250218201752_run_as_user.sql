@@ -0,0 +1,7 @@
+-- migrate:up
+alter table check_definitions add column run_as_user text not null default '';
+alter table check_definitions add column run_as_group text not null default '';
+
+-- migrate:down
+alter table check_definitions drop column run_as_group;
+alter table check_definitions drop column run_as_user;
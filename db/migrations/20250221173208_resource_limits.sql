@@ -0,0 +1,19 @@
+-- migrate:up
+alter table check_definitions add column max_memory_mb integer not null default 0 check (max_memory_mb between 0 and 65536);
+alter table check_definitions add column max_cpu_seconds integer not null default 0 check (max_cpu_seconds between 0 and 3600);
+alter table check_definitions add column max_output_bytes integer not null default 1048576 check (max_output_bytes between 1024 and 104857600);
+
+alter table check_definitions add column last_user_cpu_ms integer not null default 0;
+alter table check_definitions add column last_system_cpu_ms integer not null default 0;
+alter table check_definitions add column last_max_rss_kb integer not null default 0;
+alter table check_definitions add column total_cpu_ms integer not null default 0;
+
+-- migrate:down
+alter table check_definitions drop column total_cpu_ms;
+alter table check_definitions drop column last_max_rss_kb;
+alter table check_definitions drop column last_system_cpu_ms;
+alter table check_definitions drop column last_user_cpu_ms;
+
+alter table check_definitions drop column max_output_bytes;
+alter table check_definitions drop column max_cpu_seconds;
+alter table check_definitions drop column max_memory_mb;
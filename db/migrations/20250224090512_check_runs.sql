@@ -0,0 +1,27 @@
+-- migrate:up
+create table check_runs
+(
+    id               integer not null primary key autoincrement,
+    filename         text    not null references check_definitions (filename) on delete cascade,
+    started_at       integer not null,
+    duration_ms      integer not null,
+    exit_code        integer not null,
+    signal           text    not null default '',
+    timed_out        integer not null default 0 check (timed_out in (0, 1)),
+    error            text    not null default '',
+    stdout           text    not null default '',
+    stderr           text    not null default '',
+    output_truncated integer not null default 0 check (output_truncated in (0, 1)),
+    user_cpu_ms      integer not null default 0,
+    system_cpu_ms    integer not null default 0,
+    max_rss_kb       integer not null default 0
+) strict;
+
+create index idx_check_runs_filename on check_runs (filename, id);
+
+alter table results add column run_id integer default null references check_runs (id) on delete set null;
+
+-- migrate:down
+alter table results drop column run_id;
+
+drop table check_runs;
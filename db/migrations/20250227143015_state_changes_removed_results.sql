@@ -0,0 +1,52 @@
+-- migrate:up
+-- new_rc is null for a result that is no longer reported by its check
+create table state_changes_new
+(
+    id         integer not null primary key autoincrement,
+    filename   text    not null,
+    name       text    not null,
+    host       text             default null,
+    old_rc     integer          default null,
+    new_rc     integer          default null,
+    state_type text    not null,
+    text       text             default null,
+    timestamp  integer not null
+) strict;
+
+insert into state_changes_new (id, filename, name, host, old_rc, new_rc, state_type, text, timestamp)
+select id, filename, name, host, old_rc, new_rc, state_type, text, timestamp
+from state_changes;
+
+drop table state_changes;
+
+alter table state_changes_new rename to state_changes;
+
+create index idx_state_changes_timestamp on state_changes (timestamp);
+
+create index idx_state_changes_filename on state_changes (filename, id);
+
+-- migrate:down
+delete from state_changes where new_rc is null;
+
+create table state_changes_old
+(
+    id         integer not null primary key autoincrement,
+    filename   text    not null,
+    name       text    not null,
+    host       text             default null,
+    old_rc     integer          default null,
+    new_rc     integer not null,
+    state_type text    not null,
+    text       text             default null,
+    timestamp  integer not null
+) strict;
+
+insert into state_changes_old (id, filename, name, host, old_rc, new_rc, state_type, text, timestamp)
+select id, filename, name, host, old_rc, new_rc, state_type, text, timestamp
+from state_changes;
+
+drop table state_changes;
+
+alter table state_changes_old rename to state_changes;
+
+create index idx_state_changes_timestamp on state_changes (timestamp);
@@ -10,7 +10,7 @@ CREATE TABLE check_definitions
     timeout_seconds                        integer not null CHECK (timeout_seconds BETWEEN 1 AND 120),
     stop_checking_after_number_of_timeouts integer not null CHECK (stop_checking_after_number_of_timeouts BETWEEN 1 AND 10),
     last_run_timestamp                     integer not null default 0
-) strict;
+, output_format text not null default 'auto' check (output_format in ('nagios', 'kamonitu', 'auto')), consecutive_timeouts integer not null default 0, suspended integer not null default 0 check (suspended in (0, 1)), hook_timeout_seconds integer not null default 30 check (hook_timeout_seconds between 1 and 120), max_check_attempts integer not null default 3 check (max_check_attempts between 1 and 10), retry_interval_seconds integer not null default 30 check (retry_interval_seconds between 5 and 3600), soft_state integer not null default 0 check (soft_state in (0, 1)), flap_detection_window integer not null default 21 check (flap_detection_window between 3 and 50), flap_high_threshold integer not null default 50 check (flap_high_threshold between 1 and 100), flap_low_threshold integer not null default 25 check (flap_low_threshold between 0 and 100), schedule text not null default '', check_period text not null default '', working_directory text not null default '', shell text not null default 'true' check (shell in ('true', 'false')), run_as_user text not null default '', run_as_group text not null default '', max_memory_mb integer not null default 0 check (max_memory_mb between 0 and 65536), max_cpu_seconds integer not null default 0 check (max_cpu_seconds between 0 and 3600), max_output_bytes integer not null default 1048576 check (max_output_bytes between 1024 and 104857600), last_user_cpu_ms integer not null default 0, last_system_cpu_ms integer not null default 0, last_max_rss_kb integer not null default 0, total_cpu_ms integer not null default 0) strict;
 CREATE INDEX idx_check_definitions_filename ON check_definitions (filename);
 CREATE TABLE results
 (
@@ -20,9 +20,87 @@ CREATE TABLE results
     text     text default null,
     perfdata text default null,
     host     text default null,
-    tags     text default null,
+    tags     text default null, state_type text not null default 'HARD' check (state_type in ('SOFT', 'HARD')), attempt integer not null default 1, last_hard_rc integer not null default 0, state_history text not null default '', percent_state_change integer not null default 0, flapping integer not null default 0 check (flapping in (0, 1)), in_downtime integer not null default 0 check (in_downtime in (0, 1)), run_id integer default null references check_runs (id) on delete set null,
     foreign key (filename) references check_definitions(filename) on delete cascade on update cascade
 ) strict;
+CREATE TABLE downtimes
+(
+    id                integer not null primary key autoincrement,
+    filename          text             default null,
+    name_pattern      text             default null,
+    host              text             default null,
+    tag               text             default null,
+    start_timestamp   integer not null,
+    end_timestamp     integer not null,
+    author            text    not null,
+    comment           text             default null,
+    created_timestamp integer not null,
+    check (end_timestamp > start_timestamp),
+    check (coalesce(filename, name_pattern, host, tag) is not null)
+) strict;
+CREATE INDEX idx_downtimes_end_timestamp on downtimes (end_timestamp);
+CREATE TABLE acknowledgements
+(
+    id                integer not null primary key autoincrement,
+    filename          text    not null,
+    name              text    not null,
+    host              text    not null default '',
+    author            text    not null,
+    comment           text    not null,
+    sticky            integer not null default 0 check (sticky in (0, 1)),
+    created_timestamp integer not null,
+    expire_timestamp  integer          default null,
+    unique (filename, name, host),
+    foreign key (filename) references check_definitions (filename) on delete cascade on update cascade
+) strict;
+CREATE TABLE check_runs
+(
+    id               integer not null primary key autoincrement,
+    filename         text    not null references check_definitions (filename) on delete cascade,
+    started_at       integer not null,
+    duration_ms      integer not null,
+    exit_code        integer not null,
+    signal           text    not null default '',
+    timed_out        integer not null default 0 check (timed_out in (0, 1)),
+    error            text    not null default '',
+    stdout           text    not null default '',
+    stderr           text    not null default '',
+    output_truncated integer not null default 0 check (output_truncated in (0, 1)),
+    user_cpu_ms      integer not null default 0,
+    system_cpu_ms    integer not null default 0,
+    max_rss_kb       integer not null default 0
+) strict;
+CREATE INDEX idx_check_runs_filename on check_runs (filename, id);
+CREATE TABLE IF NOT EXISTS "state_changes"
+(
+    id         integer not null primary key autoincrement,
+    filename   text    not null,
+    name       text    not null,
+    host       text             default null,
+    old_rc     integer          default null,
+    new_rc     integer          default null,
+    state_type text    not null,
+    text       text             default null,
+    timestamp  integer not null
+) strict;
+CREATE INDEX idx_state_changes_timestamp on state_changes (timestamp);
+CREATE INDEX idx_state_changes_filename on state_changes (filename, id);
 -- Dbmate schema migrations
 INSERT INTO "schema_migrations" (version) VALUES
-  ('20250106102647');
+  ('20250106102647'),
+  ('20250112093015'),
+  ('20250115201130'),
+  ('20250118154210'),
+  ('20250120183305'),
+  ('20250124110740'),
+  ('20250127172402'),
+  ('20250130085521'),
+  ('20250203141958'),
+  ('20250206093347'),
+  ('20250209162544'),
+  ('20250212191036'),
+  ('20250215104417'),
+  ('20250218201752'),
+  ('20250221173208'),
+  ('20250224090512'),
+  ('20250227143015');
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"log/slog"
+	"os"
+	"os/user"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Downtime is a scheduled maintenance window, a single row of the table downtimes.
+// A downtime applies to all results that match every criterion that is set: check definition filename,
+// result name pattern (see path.Match), host and tag.
+type Downtime struct {
+	Id               int64  `db:"id"`
+	Filename         string `db:"filename"`
+	NamePattern      string `db:"name_pattern"`
+	Host             string `db:"host"`
+	Tag              string `db:"tag"`
+	StartTimestamp   int64  `db:"start_timestamp"`
+	EndTimestamp     int64  `db:"end_timestamp"`
+	Author           string `db:"author"`
+	Comment          string `db:"comment"`
+	CreatedTimestamp int64  `db:"created_timestamp"`
+}
+
+const downtimeColumns = `id, coalesce(filename, '') as filename, coalesce(name_pattern, '') as name_pattern, coalesce(host, '') as host, coalesce(tag, '') as tag, 
+		start_timestamp, end_timestamp, author, coalesce(comment, '') as comment, created_timestamp`
+
+// matches returns true if the result matches all criteria of the downtime.
+func (d Downtime) matches(result Result) bool {
+	if d.Filename != "" && d.Filename != result.Filename {
+		return false
+	}
+	if d.NamePattern != "" {
+		if ok, _ := path.Match(d.NamePattern, result.Name); !ok {
+			return false
+		}
+	}
+	if d.Host != "" && d.Host != result.Host {
+		return false
+	}
+	if d.Tag != "" && !slices.Contains(splitTags(result.Tags), d.Tag) {
+		return false
+	}
+	return true
+}
+
+// validate checks that at least one criterion is set, the name pattern is valid and the downtime ends after it starts.
+func (d Downtime) validate() error {
+	if d.Filename == "" && d.NamePattern == "" && d.Host == "" && d.Tag == "" {
+		return fmt.Errorf("downtime benötigt mindestens eines von check, name, host oder tag")
+	}
+	if _, err := path.Match(d.NamePattern, ""); err != nil {
+		return fmt.Errorf("ungültiges name pattern %q: %v", d.NamePattern, err)
+	}
+	if d.EndTimestamp <= d.StartTimestamp {
+		return fmt.Errorf("downtime muss nach dem Start enden")
+	}
+	return nil
+}
+
+// splitTags splits the comma separated tags of a result.
+func splitTags(tags string) []string {
+	result := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// addDowntime validates and stores a downtime. Returns the id of the new downtime.
+func addDowntime(downtime Downtime) (int64, error) {
+	err := downtime.validate()
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Exec("INSERT INTO downtimes (filename, name_pattern, host, tag, start_timestamp, end_timestamp, author, comment, created_timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		nullIfEmpty(downtime.Filename), nullIfEmpty(downtime.NamePattern), nullIfEmpty(downtime.Host), nullIfEmpty(downtime.Tag),
+		downtime.StartTimestamp, downtime.EndTimestamp, downtime.Author, nullIfEmpty(downtime.Comment), time.Now().Unix())
+	if err != nil {
+		slog.Error("Error inserting downtime", "err", err)
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Downtime added", "id", id, "downtime", downtime)
+	return id, nil
+}
+
+// loadDowntimes returns all downtimes, by default only those that did not end yet.
+func loadDowntimes(includeEnded bool) ([]Downtime, error) {
+	query := "SELECT " + downtimeColumns + " FROM downtimes"
+	args := []any{}
+	if !includeEnded {
+		query += " WHERE end_timestamp > ?"
+		args = append(args, time.Now().Unix())
+	}
+	query += " ORDER BY start_timestamp, id"
+	downtimes := []Downtime{}
+	err := db.Select(&downtimes, query, args...)
+	if err != nil {
+		slog.Error("Error selecting downtimes", "err", err)
+		return nil, err
+	}
+	return downtimes, nil
+}
+
+// activeDowntimes returns the downtimes that are active at the given time.
+func activeDowntimes(tx *sqlx.Tx, now time.Time) ([]Downtime, error) {
+	downtimes := []Downtime{}
+	err := tx.Select(&downtimes, "SELECT "+downtimeColumns+" FROM downtimes WHERE start_timestamp <= ? AND end_timestamp > ?", now.Unix(), now.Unix())
+	return downtimes, err
+}
+
+// removeDowntime deletes a downtime.
+func removeDowntime(id int64) error {
+	res, err := db.Exec("DELETE FROM downtimes WHERE id = ?", id)
+	if err != nil {
+		slog.Error("Error deleting downtime", "id", id, "err", err)
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("downtime %d nicht gefunden", id)
+	}
+	slog.Info("Downtime removed", "id", id)
+	return nil
+}
+
+// applyDowntimes marks the results that match an active downtime.
+func applyDowntimes(downtimes []Downtime, results []Result) []Result {
+	for i := range results {
+		results[i].InDowntime = slices.ContainsFunc(downtimes, func(d Downtime) bool { return d.matches(results[i]) })
+	}
+	return results
+}
+
+// currentUsername returns the name of the user running kamonitu, used as author of downtimes.
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
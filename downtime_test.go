@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDowntimeMatches(t *testing.T) {
+	result := Result{Filename: "switch.ini", Name: "Port 3", Host: "myswitch.home.lab", Tags: "network,homelab"}
+	tests := []struct {
+		name     string
+		downtime Downtime
+		want     bool
+	}{
+		{name: "check", downtime: Downtime{Filename: "switch.ini"}, want: true},
+		{name: "other check", downtime: Downtime{Filename: "swap.ini"}, want: false},
+		{name: "name pattern", downtime: Downtime{NamePattern: "Port *"}, want: true},
+		{name: "other name pattern", downtime: Downtime{NamePattern: "Port 1*"}, want: false},
+		{name: "host", downtime: Downtime{Host: "myswitch.home.lab"}, want: true},
+		{name: "tag", downtime: Downtime{Tag: "homelab"}, want: true},
+		{name: "other tag", downtime: Downtime{Tag: "home"}, want: false},
+		{name: "all criteria", downtime: Downtime{Filename: "switch.ini", NamePattern: "Port ?", Host: "myswitch.home.lab", Tag: "network"}, want: true},
+		{name: "one criterion does not match", downtime: Downtime{Filename: "switch.ini", Tag: "server"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.downtime.matches(result))
+		})
+	}
+}
+
+func TestDowntimes(t *testing.T) {
+	makeTestDatabase(t)
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"max_check_attempts": "1"})
+	store := CheckDefinitionFileStore{
+		db:               db,
+		CheckDefinitions: map[string]CheckDefinition{"switch.ini": checkDefinition},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	now := time.Now()
+	_, err := addDowntime(Downtime{Author: "test", StartTimestamp: now.Unix(), EndTimestamp: now.Add(time.Hour).Unix()})
+	assert.Error(t, err, "downtime without criteria")
+	_, err = addDowntime(Downtime{Tag: "network", Author: "test", StartTimestamp: now.Unix(), EndTimestamp: now.Unix()})
+	assert.Error(t, err, "downtime ends before it starts")
+	_, err = addDowntime(Downtime{Tag: "network", Author: "test", StartTimestamp: now.Add(time.Hour).Unix(), EndTimestamp: now.Add(2 * time.Hour).Unix()})
+	assert.NoError(t, err)
+	id, err := addDowntime(Downtime{NamePattern: "Port [12]", Author: "test", StartTimestamp: now.Add(-time.Minute).Unix(), EndTimestamp: now.Add(time.Hour).Unix()})
+	assert.NoError(t, err)
+
+	downtimes, err := loadDowntimes(false)
+	assert.NoError(t, err)
+	assert.Len(t, downtimes, 2)
+
+	results, err := ReplaceResults("switch.ini", checkDefinition, parseKamonituOutput("switch.ini", "|2|Port 1|down||switch|network\n|2|Port 3|down||switch|network\n"))
+	assert.NoError(t, err)
+	assert.True(t, results[0].InDowntime)
+	assert.False(t, results[1].InDowntime, "the downtime for the tag network did not start yet")
+
+	assert.NoError(t, removeDowntime(id))
+	assert.Error(t, removeDowntime(id))
+	results, err = ReplaceResults("switch.ini", checkDefinition, parseKamonituOutput("switch.ini", "|2|Port 1|down||switch|network\n"))
+	assert.NoError(t, err)
+	assert.False(t, results[0].InDowntime)
+}
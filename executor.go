@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+)
+
+const (
+	// killGracePeriod is the time between SIGTERM and SIGKILL when a check times out
+	killGracePeriod = 5 * time.Second
+)
+
+// ExecutionResult is the outcome of a single execution of a check command.
+type ExecutionResult struct {
+	StartedAt time.Time
+	ExitCode  int            // -1 if the process was killed by a signal or could not be started
+	Signal    syscall.Signal // the signal that killed the process, 0 if it exited
+	Stdout    string
+	Stderr    string
+	Duration  time.Duration
+	TimedOut  bool
+	Err       error // set if the command could not be started or waited for
+	// Aborted is set if the process group was killed because ctx was cancelled, e.g. at the end of the shutdown grace period
+	Aborted bool
+	// OutputTruncated is set if stdout or stderr exceeded max_output_bytes
+	OutputTruncated bool
+	ResourceUsage   resourceUsage
+}
+
+// executeCheck runs the CheckCommand of the check definition and enforces TimeoutSeconds.
+// If ctx is cancelled, the check is killed.
+func executeCheck(ctx context.Context, checkDefinition CheckDefinition) ExecutionResult {
+	cmd, err := checkCommand(checkDefinition)
+	if err != nil {
+		slog.Error("Error building check command", "command", checkDefinition.CheckCommand, "err", err)
+		return ExecutionResult{StartedAt: time.Now(), ExitCode: -1, Err: err}
+	}
+	return executeCommand(ctx, cmd, time.Duration(checkDefinition.TimeoutSeconds)*time.Second, checkResourceLimits(checkDefinition))
+}
+
+// checkCommand builds the command of a check definition: with shell = true via /bin/sh -c, otherwise the
+// CheckCommand is split into arguments like a shell would and executed directly.
+// The environment of kamonitu is extended by the env.<NAME> keys, the working directory is set if configured
+// and the command runs as run_as_user and run_as_group.
+func checkCommand(checkDefinition CheckDefinition) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if checkDefinition.Shell == "false" {
+		args, err := splitCommandLine(checkDefinition.CheckCommand)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", checkDefinition.CheckCommand)
+	}
+	cmd.Dir = checkDefinition.WorkingDirectory
+	credential, err := checkCredential(checkDefinition)
+	if err != nil {
+		return nil, err
+	}
+	if credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+	if len(checkDefinition.Environment) > 0 {
+		cmd.Env = os.Environ()
+		for _, name := range slices.Sorted(maps.Keys(checkDefinition.Environment)) {
+			cmd.Env = append(cmd.Env, name+"="+checkDefinition.Environment[name])
+		}
+	}
+	return cmd, nil
+}
+
+// checkCredential returns the credential of run_as_user and run_as_group of a check definition, or nil if neither is set.
+// Without run_as_group the primary and supplementary groups of run_as_user are used.
+func checkCredential(checkDefinition CheckDefinition) (*syscall.Credential, error) {
+	if checkDefinition.RunAsUser == "" && checkDefinition.RunAsGroup == "" {
+		return nil, nil
+	}
+	credential := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if checkDefinition.RunAsUser != "" {
+		u, err := user.Lookup(checkDefinition.RunAsUser)
+		if err != nil {
+			return nil, fmt.Errorf("run_as_user: %v", err)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("run_as_user %q: ungültige uid %q", checkDefinition.RunAsUser, u.Uid)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("run_as_user %q: ungültige gid %q", checkDefinition.RunAsUser, u.Gid)
+		}
+		credential.Uid = uint32(uid)
+		credential.Gid = uint32(gid)
+		if checkDefinition.RunAsGroup == "" {
+			groupIds, err := u.GroupIds()
+			if err != nil {
+				return nil, fmt.Errorf("run_as_user %q: %v", checkDefinition.RunAsUser, err)
+			}
+			for _, groupId := range groupIds {
+				gid, err := strconv.ParseUint(groupId, 10, 32)
+				if err == nil {
+					credential.Groups = append(credential.Groups, uint32(gid))
+				}
+			}
+		}
+	}
+	if checkDefinition.RunAsGroup != "" {
+		g, err := user.LookupGroup(checkDefinition.RunAsGroup)
+		if err != nil {
+			return nil, fmt.Errorf("run_as_group: %v", err)
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("run_as_group %q: ungültige gid %q", checkDefinition.RunAsGroup, g.Gid)
+		}
+		credential.Gid = uint32(gid)
+		credential.Groups = []uint32{uint32(gid)}
+	}
+	return credential, nil
+}
+
+// splitCommandLine splits a command line into arguments like a shell would: arguments are separated by
+// whitespace, single quotes preserve everything, double quotes preserve everything except backslash escapes
+// and a backslash outside of quotes escapes the next character. Variables and globs are not expanded.
+func splitCommandLine(commandLine string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range commandLine {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("fehlendes schließendes %c in %q", quote, commandLine)
+	}
+	if escaped {
+		return nil, fmt.Errorf("backslash am Ende von %q", commandLine)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("leeres Kommando")
+	}
+	return args, nil
+}
+
+// validateCheckExecutable verifies that the executable of a check definition exists. With shell = false the first
+// argument must resolve on PATH, with shell = true only an absolute path as first word of the command is verified,
+// as it may be a shell builtin or syntax.
+func validateCheckExecutable(checkDefinition CheckDefinition) error {
+	args, err := splitCommandLine(checkDefinition.CheckCommand)
+	if err != nil {
+		return err
+	}
+	if checkDefinition.Shell != "false" && !filepath.IsAbs(args[0]) {
+		return nil
+	}
+	_, err = exec.LookPath(args[0])
+	if err != nil {
+		return fmt.Errorf("executable %q nicht gefunden: %v", args[0], err)
+	}
+	return nil
+}
+
+// executeCommand starts cmd in its own process group and waits for it to finish.
+// If cmd does not finish within timeout, the whole process group gets a SIGTERM and,
+// if any process of the group is still running after killGracePeriod, a SIGKILL - even if the plugin itself already exited.
+// So children forked by a plugin are not left behind.
+// If ctx is cancelled while cmd is running, the process group gets a SIGKILL immediately and the result is Aborted.
+// The memory and cpu limits are set before cmd is executed, the captured output is cut at limits.outputBytes.
+func executeCommand(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, limits resourceLimits) ExecutionResult {
+	var stdout, stderr bytes.Buffer
+	limitedStdout := &limitedWriter{w: &stdout, limit: limits.outputBytes}
+	limitedStderr := &limitedWriter{w: &stderr, limit: limits.outputBytes}
+	cmd.Stdout = limitedStdout
+	cmd.Stderr = limitedStderr
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	// Do not wait forever for output pipes that are held open by processes that left the process group
+	cmd.WaitDelay = killGracePeriod
+
+	limits.wrap(cmd)
+
+	startedAt := time.Now()
+	result := ExecutionResult{ExitCode: -1, StartedAt: startedAt}
+	err := cmd.Start()
+	if err != nil {
+		slog.Error("Error starting command", "command", cmd.String(), "err", err)
+		result.Err = err
+		return result
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		result.Aborted = true
+		slog.Warn("Command aborted - killing process group", "command", cmd.String(), "pid", cmd.Process.Pid)
+		killProcessGroup(cmd.Process.Pid, syscall.SIGKILL)
+		err = <-done
+	case <-timer.C:
+		result.TimedOut = true
+		slog.Warn("Command timed out - terminating process group", "command", cmd.String(), "timeout", timeout, "pid", cmd.Process.Pid)
+		killProcessGroup(cmd.Process.Pid, syscall.SIGTERM)
+		grace := time.NewTimer(killGracePeriod)
+		defer grace.Stop()
+		select {
+		case err = <-done:
+			// The group leader is gone, but children that ignore SIGTERM may still be running in its process group
+			waitForProcessGroup(cmd.String(), cmd.Process.Pid, grace.C)
+		case <-grace.C:
+			slog.Warn("Process group still running after grace period - killing it", "command", cmd.String(), "pid", cmd.Process.Pid)
+			killProcessGroup(cmd.Process.Pid, syscall.SIGKILL)
+			err = <-done
+		}
+	}
+	result.Duration = time.Since(startedAt)
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.OutputTruncated = limitedStdout.truncated || limitedStderr.truncated
+	if result.OutputTruncated {
+		slog.Warn("Output of command truncated", "command", cmd.String(), "maxOutputBytes", limits.outputBytes)
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+		result.ResourceUsage = resourceUsageOf(cmd.ProcessState.SysUsage())
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			result.Signal = status.Signal()
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, exec.ErrWaitDelay) {
+		slog.Error("Error waiting for command", "command", cmd.String(), "err", err)
+		result.Err = err
+	}
+	return result
+}
+
+// waitForProcessGroup waits until all processes of the process group pgid have exited.
+// If processes are left when deadline fires, the process group gets a SIGKILL.
+func waitForProcessGroup(command string, pgid int, deadline <-chan time.Time) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for processGroupExists(pgid) {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			slog.Warn("Process group still running after grace period - killing it", "command", command, "pid", pgid)
+			killProcessGroup(pgid, syscall.SIGKILL)
+			return
+		}
+	}
+}
+
+// processGroupExists returns true if there is at least one process in the process group pgid.
+func processGroupExists(pgid int) bool {
+	return !errors.Is(syscall.Kill(-pgid, 0), syscall.ESRCH)
+}
+
+// killProcessGroup sends signal to all processes in the process group pgid.
+func killProcessGroup(pgid int, signal syscall.Signal) {
+	err := syscall.Kill(-pgid, signal)
+	if err != nil && !errors.Is(err, syscall.ESRCH) {
+		slog.Error("Error sending signal to process group", "pgid", pgid, "signal", signal, "err", err)
+	}
+}
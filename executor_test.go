@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteCheck(t *testing.T) {
+	result := executeCheck(context.Background(), CheckDefinition{CheckCommand: "echo out; echo err >&2; exit 2", TimeoutSeconds: 10})
+	assert.NoError(t, result.Err)
+	assert.False(t, result.TimedOut)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Equal(t, "out\n", result.Stdout)
+	assert.Equal(t, "err\n", result.Stderr)
+	assert.Greater(t, result.Duration, time.Duration(0))
+}
+
+func TestExecuteCheckEnvironmentWorkingDirectoryAndShell(t *testing.T) {
+	dir := t.TempDir()
+	checkDefinition := CheckDefinition{
+		CheckCommand:     `sh -c 'echo "$GREETING $1 $(pwd)"' check 'shell "less"'`,
+		TimeoutSeconds:   10,
+		Shell:            "false",
+		WorkingDirectory: dir,
+		Environment:      map[string]string{"GREETING": "hello"},
+	}
+	result := executeCheck(context.Background(), checkDefinition)
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "hello shell \"less\" "+dir+"\n", result.Stdout)
+
+	checkDefinition.Shell = "true"
+	checkDefinition.CheckCommand = "echo $GREETING; pwd"
+	result = executeCheck(context.Background(), checkDefinition)
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "hello\n"+dir+"\n", result.Stdout)
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		commandLine string
+		want        []string
+	}{
+		{"/usr/bin/check_swap -w 10% -c 5%", []string{"/usr/bin/check_swap", "-w", "10%", "-c", "5%"}},
+		{"  check   'a b'  \"c \\\" d\" ", []string{"check", "a b", `c " d`}},
+		{`check a\ b '' "it's"`, []string{"check", "a b", "", "it's"}},
+		{`check "$HOME" *`, []string{"check", "$HOME", "*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.commandLine, func(t *testing.T) {
+			args, err := splitCommandLine(tt.commandLine)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, args)
+		})
+	}
+	for _, commandLine := range []string{"", "   ", "check 'a", `check "a`, `check a\`} {
+		_, err := splitCommandLine(commandLine)
+		assert.Error(t, err, commandLine)
+	}
+}
+
+func TestValidateCheckExecutable(t *testing.T) {
+	assert.NoError(t, validateCheckExecutable(CheckDefinition{CheckCommand: "sh -c true", Shell: "false"}))
+	assert.Error(t, validateCheckExecutable(CheckDefinition{CheckCommand: "check_nothing_kamonitu", Shell: "false"}))
+	assert.NoError(t, validateCheckExecutable(CheckDefinition{CheckCommand: "cd /tmp && true", Shell: "true"}), "shell builtins are not verified")
+	assert.Error(t, validateCheckExecutable(CheckDefinition{CheckCommand: "/nonexistent/check_nothing -w 1", Shell: "true"}))
+}
+
+func TestCheckCredential(t *testing.T) {
+	credential, err := checkCredential(CheckDefinition{})
+	assert.NoError(t, err)
+	assert.Nil(t, credential)
+
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("user nobody does not exist")
+	}
+	credential, err = checkCredential(CheckDefinition{RunAsUser: "nobody"})
+	assert.NoError(t, err)
+	assert.Equal(t, nobody.Uid, strconv.Itoa(int(credential.Uid)))
+	assert.Equal(t, nobody.Gid, strconv.Itoa(int(credential.Gid)))
+
+	root, err := user.LookupGroupId("0")
+	assert.NoError(t, err)
+	credential, err = checkCredential(CheckDefinition{RunAsUser: "nobody", RunAsGroup: root.Name})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), credential.Gid)
+	assert.Equal(t, []uint32{0}, credential.Groups)
+
+	_, err = checkCredential(CheckDefinition{RunAsUser: "kamonitu_nonexistent_user"})
+	assert.Error(t, err)
+	_, err = checkCredential(CheckDefinition{RunAsGroup: "kamonitu_nonexistent_group"})
+	assert.Error(t, err)
+
+	if os.Getuid() != 0 {
+		t.Skip("dropping privileges needs root")
+	}
+	result := executeCheck(context.Background(), CheckDefinition{CheckCommand: "id -u", TimeoutSeconds: 10, RunAsUser: "nobody"})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, nobody.Uid+"\n", result.Stdout)
+}
+
+func TestExecuteCommandNotFound(t *testing.T) {
+	result := executeCommand(context.Background(), exec.Command("/nonexistent/check_nothing"), time.Second, resourceLimits{})
+	assert.Error(t, result.Err)
+	assert.Equal(t, -1, result.ExitCode)
+}
+
+func TestExecuteCheckTimeoutKillsProcessGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+	}{
+		// The child ignores SIGTERM, so the process group has to be killed with SIGKILL after the grace period
+		{"leader keeps running", "sh -c 'trap \"\" TERM; sleep 60' & echo $! > %s; wait"},
+		// The leader exits on SIGTERM, the child ignoring SIGTERM is left alone in the process group
+		{"leader exits", "sh -c 'trap \"\" TERM; sleep 60' >/dev/null 2>&1 </dev/null & echo $! > %s; sleep 60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pidFile := t.TempDir() + "/child.pid"
+			result := executeCheck(context.Background(), CheckDefinition{CheckCommand: fmt.Sprintf(tt.command, pidFile), TimeoutSeconds: 1})
+			assert.True(t, result.TimedOut)
+			assert.Less(t, result.Duration, time.Second+killGracePeriod+2*time.Second)
+
+			content, err := os.ReadFile(pidFile)
+			assert.NoError(t, err)
+			pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+			assert.NoError(t, err)
+			assert.Eventually(t, func() bool { return !processIsRunning(pid) }, time.Second, 10*time.Millisecond, "child process %d is still running", pid)
+		})
+	}
+}
+
+// processIsRunning returns true if the process exists and is not a zombie.
+func processIsRunning(pid int) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// Format: pid (comm) state ...
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
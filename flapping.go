@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// applyFlapDetection appends the rc of each result to the state history of its service and computes the
+// percent state change over the last FlapDetectionWindow runs. A service starts flapping when the percent
+// state change reaches FlapHighThreshold and stops flapping when it falls below FlapLowThreshold.
+// Until the state history is as long as the window, a service is not considered flapping.
+func applyFlapDetection(previousResults []Result, results []Result, checkDefinition CheckDefinition) []Result {
+	previous := resultsByKey(previousResults)
+	for i := range results {
+		result := &results[i]
+		prev := previous[resultKey{result.Name, result.Host}]
+
+		history := append(parseStateHistory(prev.StateHistory), result.Rc)
+		if len(history) > checkDefinition.FlapDetectionWindow {
+			history = history[len(history)-checkDefinition.FlapDetectionWindow:]
+		}
+		result.StateHistory = formatStateHistory(history)
+		result.PercentStateChange = percentStateChange(history)
+
+		switch {
+		case len(history) < checkDefinition.FlapDetectionWindow:
+			result.Flapping = false
+		case prev.Flapping:
+			result.Flapping = result.PercentStateChange >= checkDefinition.FlapLowThreshold
+		default:
+			result.Flapping = result.PercentStateChange >= checkDefinition.FlapHighThreshold
+		}
+		if result.Flapping != prev.Flapping {
+			slog.Info("Flapping changed", "filename", result.Filename, "name", result.Name, "host", result.Host, "flapping", result.Flapping, "percentStateChange", result.PercentStateChange)
+		}
+	}
+	return results
+}
+
+// percentStateChange returns the percentage of state changes between consecutive runs in the history.
+func percentStateChange(history []int) int {
+	if len(history) < 2 {
+		return 0
+	}
+	changes := 0
+	for i := 1; i < len(history); i++ {
+		if history[i] != history[i-1] {
+			changes++
+		}
+	}
+	return changes * 100 / (len(history) - 1)
+}
+
+// parseStateHistory parses the comma separated rcs of the column state_history, oldest first.
+func parseStateHistory(s string) []int {
+	history := []int{}
+	for _, field := range strings.Split(s, ",") {
+		rc, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		history = append(history, rc)
+	}
+	return history
+}
+
+// formatStateHistory formats the rcs for the column state_history.
+func formatStateHistory(history []int) string {
+	fields := make([]string, len(history))
+	for i, rc := range history {
+		fields[i] = strconv.Itoa(rc)
+	}
+	return strings.Join(fields, ",")
+}
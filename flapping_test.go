@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPercentStateChange(t *testing.T) {
+	assert.Equal(t, 0, percentStateChange(nil))
+	assert.Equal(t, 0, percentStateChange([]int{2}))
+	assert.Equal(t, 0, percentStateChange([]int{0, 0, 0, 0, 0}))
+	assert.Equal(t, 100, percentStateChange([]int{0, 2, 0, 2, 0}))
+	assert.Equal(t, 50, percentStateChange([]int{0, 0, 2, 2, 0}))
+}
+
+func TestApplyFlapDetection(t *testing.T) {
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"flap_detection_window": "5", "flap_high_threshold": "50", "flap_low_threshold": "25"})
+	run := func(previous Result, rc int) Result {
+		return applyFlapDetection([]Result{previous}, []Result{{Name: "Swap", Rc: rc}}, checkDefinition)[0]
+	}
+
+	result := Result{Name: "Swap"}
+	for _, rc := range []int{0, 2, 0, 2} {
+		result = run(result, rc)
+		assert.False(t, result.Flapping, "not flapping until the window is filled")
+	}
+	assert.Equal(t, "0,2,0,2", result.StateHistory)
+
+	result = run(result, 0)
+	assert.Equal(t, "0,2,0,2,0", result.StateHistory)
+	assert.Equal(t, 100, result.PercentStateChange)
+	assert.True(t, result.Flapping)
+
+	// Stays flapping until the percent state change falls below the low threshold
+	result = run(result, 0)
+	assert.Equal(t, "2,0,2,0,0", result.StateHistory)
+	assert.Equal(t, 75, result.PercentStateChange)
+	assert.True(t, result.Flapping)
+	result = run(result, 0)
+	result = run(result, 0)
+	assert.Equal(t, 25, result.PercentStateChange)
+	assert.True(t, result.Flapping)
+	result = run(result, 0)
+	assert.Equal(t, 0, result.PercentStateChange)
+	assert.False(t, result.Flapping)
+}
+
+func TestValidateCheckDefinitionFlapThresholds(t *testing.T) {
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"flap_high_threshold": "20", "flap_low_threshold": "20"})
+	assert.Error(t, validateCheckDefinition(&checkDefinition))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// StateChange is a single row of the table state_changes.
+type StateChange struct {
+	Filename  string        `db:"filename"`
+	Name      string        `db:"name"`
+	Host      string        `db:"host"`
+	OldRc     sql.NullInt64 `db:"old_rc"`
+	NewRc     sql.NullInt64 `db:"new_rc"` // null if the result is no longer reported
+	StateType string        `db:"state_type"`
+	Text      string        `db:"text"`
+	Timestamp int64         `db:"timestamp"`
+}
+
+// loadStateChanges returns the state changes since the given time, oldest first.
+// filename and name restrict the state changes to a check definition or result name, if not empty.
+func loadStateChanges(filename string, name string, since time.Time) ([]StateChange, error) {
+	query := `SELECT filename, name, coalesce(host, '') as host, old_rc, new_rc, state_type, coalesce(text, '') as text, timestamp 
+			FROM state_changes 
+			WHERE timestamp >= ?`
+	args := []any{since.Unix()}
+	if filename != "" {
+		query += " AND filename = ?"
+		args = append(args, filename)
+	}
+	if name != "" {
+		query += " AND name = ?"
+		args = append(args, name)
+	}
+	query += " ORDER BY timestamp, id"
+
+	stateChanges := []StateChange{}
+	err := db.Select(&stateChanges, query, args...)
+	if err != nil {
+		slog.Error("Error selecting state changes", "query", query, "err", err)
+		return nil, err
+	}
+	return stateChanges, nil
+}
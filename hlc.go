@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-multierror"
 	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func validateConfigHlc(config *AppConfig) error {
@@ -18,6 +27,20 @@ func validateConfigHlc(config *AppConfig) error {
 	if err != nil {
 		return err
 	}
+	var errors *multierror.Error
+	for filename, checkDefinition := range store.CheckDefinitions {
+		err = validateCheckExecutable(checkDefinition)
+		if err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("check definition %q: %v", filename, err))
+		}
+		_, err = checkCredential(checkDefinition)
+		if err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("check definition %q: %v", filename, err))
+		}
+	}
+	if errors.ErrorOrNil() != nil {
+		return errors
+	}
 	fmt.Printf("Validate Check Definition Configs aus '%s' sind %v\n", config.CheckDefinitionsDir, color.GreenString("korrekt"))
 	return nil
 }
@@ -60,12 +83,30 @@ func showConfigHlc(config *AppConfig) error {
 	PrintSimpleTableWithWidth([]string{"Key", "Value", "Source"}, contentAppConfig, width)
 	fmt.Println()
 
+	if len(store.TimePeriods) > 0 {
+		fmt.Printf("--> Timeperiods %s\n", config.ConfigDir+"/"+timePeriodsFileName)
+		content = make([][]string, 0, len(store.TimePeriods))
+		for name, period := range store.TimePeriods {
+			content = append(content, []string{name, period.Definition})
+		}
+		sort2DSlice(content)
+		printSimpleTable([]string{"Name", "Definition"}, content)
+		fmt.Println()
+	}
+
 	for fileName, checkDefinition := range store.CheckDefinitions {
 		m, order = structToMap(checkDefinition)
 		fmt.Printf("--> CheckDefinition %s\n", store.directory+"/"+fileName)
 		content = make([][]string, len(order))
 		for i, v := range order {
-			content[i] = []string{v, m[v], store.CheckDefinitionSources[fileName][v]}
+			value := m[v]
+			if period := store.TimePeriods[checkDefinition.CheckPeriod]; v == "check_period" && period != nil {
+				value = period.String()
+			}
+			content[i] = []string{v, value, store.CheckDefinitionSources[fileName][v]}
+		}
+		for name, value := range checkDefinition.Environment {
+			content = append(content, []string{environmentKeyPrefix + name, value, store.CheckDefinitionSources[fileName][environmentKeyPrefix+name]})
 		}
 		sort2DSlice(content)
 		printSimpleTable([]string{"Key", "Value", "Source"}, content)
@@ -184,12 +225,20 @@ func DescribeConfigFilesHlc(appConfig *AppConfig) error {
 }
 
 func RunHlc(config *AppConfig) error {
-	// Migrate Database
-	err := migrateDatabase(config.DbFile())
+	// Only one daemon may work on the database
+	lock, err := acquireInstanceLock(config.LockFile())
 	if err != nil {
-		slog.Error("Error running database migrations", "err", err)
+		slog.Error("Error acquiring instance lock", "err", err)
 		return err
 	}
+	defer lock.release()
+
+	// Migrate Database and get Database Connection
+	mydb, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
 
 	// Create CheckDefinitionStore
 	store, err := makeCheckDefinitionFileStore(*config)
@@ -199,39 +248,570 @@ func RunHlc(config *AppConfig) error {
 	// Load CheckDefinitions
 	err = store.LoadCheckDefinitionsFromDisk()
 	slog.Info("Loaded Check Definitions", "count", len(store.CheckDefinitions))
+	error_list := []string{}
 	if err != nil {
-		error_list := []string{}
 		if merr, ok := err.(*multierror.Error); ok {
 			for _, individualErr := range merr.Errors {
 				slog.Warn("Error in check definition - Write it as failed check into database", "error", individualErr)
 				error_list = append(error_list, individualErr.Error())
 			}
 		}
-		err = ReplaceKamonituResults(error_list, "LoadCheckDefinitionsFromDisk")
-		if err != nil {
-			slog.Error("Error replacing kamonitu results", "err", err)
-			return err
-		}
+	}
+	store.recordLoad(len(error_list) == 0, time.Now())
+	// Always replace, so errors of previous runs are removed when the check definitions are fixed
+	err = ReplaceKamonituResults(error_list, loadCheckDefinitionsTag)
+	if err != nil {
+		slog.Error("Error replacing kamonitu results", "err", err)
+		return err
 	}
 	if len(store.CheckDefinitions) == 0 {
 		slog.Warn("No Check Definitions found")
 		return fmt.Errorf("no check definitions found")
 	}
 
-	// get Database Connection
-	mydb, err := initDB(config.DbFile())
+	store.db = mydb
+	err = store.ensureCheckDefinitionsInDatabase()
+	if err != nil {
+		slog.Error("Error ensuring check definitions in database", "err", err)
+		return err
+	}
+
+	// Run the scheduler until SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	scheduler := makeScheduler(config, store)
+
+	// The database is migrated and the check definitions are in sync, so systemd can consider kamonitu started
+	notifier, err := makeSdNotifier()
+	if err != nil {
+		slog.Warn("Error connecting to systemd - not notifying it", "err", err)
+	}
+	defer notifier.close()
+	scheduler.notifier = notifier
+	notifier.notify("READY=1\nSTATUS=" + scheduler.status(time.Now()))
+
+	// Reload the check definitions on SIGHUP and when they change on disk
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				scheduler.requestReload("SIGHUP")
+			}
+		}
+	}()
+	watcher, err := makeConfigWatcher(config)
+	if err != nil {
+		slog.Warn("Check definitions are not watched for changes - reload them with SIGHUP", "err", err)
+	} else {
+		go watcher.run(ctx, scheduler.requestReload)
+	}
+
+	return scheduler.Run(ctx)
+}
+
+// RunCheckHlc executes a single check definition once in the foreground and prints its results and raw output.
+// With store the results are written into the database like the daemon would, hooks are not run.
+// Returns the worst rc of the results.
+func RunCheckHlc(config *AppConfig, check string, store bool) (int, error) {
+	path := check
+	if _, err := os.Stat(path); err != nil {
+		path = config.CheckDefinitionsDir + "/" + checkDefinitionFilename(check)
+	}
+	filename := filepath.Base(path)
+
+	if store {
+		// the daemon does not know check definitions outside of check_definitions, so their results can not be stored
+		directory, _ := filepath.Abs(filepath.Dir(path))
+		checkDefinitionsDir, _ := filepath.Abs(config.CheckDefinitionsDir)
+		if directory != checkDefinitionsDir {
+			return rcUnknown, fmt.Errorf("--store ist nur für Check Definitionen in %s möglich, nicht für %s", config.CheckDefinitionsDir, path)
+		}
+	}
+
+	fileStore, err := makeCheckDefinitionFileStore(*config)
+	if err != nil {
+		return rcUnknown, err
+	}
+	checkDefinition, _, err := loadSingleCheckDefinitionFromFile(path)
+	if err != nil {
+		return rcUnknown, err
+	}
+
+	fmt.Printf("Führe %s aus: %s\n", path, checkDefinition.CheckCommand)
+	execution := executeCheck(context.Background(), *checkDefinition)
+	results := resultsFromExecution(filename, *checkDefinition, execution)
+
+	if store {
+		// Without a daemon the lock keeps one from starting while the definition is written. A running daemon
+		// owns the check definitions, only the results of a definition it knows are stored then.
+		daemonRunning, pid, err := instanceLockHolder(config.LockFile())
+		if err != nil {
+			return rcUnknown, err
+		}
+		if !daemonRunning {
+			lock, err := acquireInstanceLock(config.LockFile())
+			if err != nil {
+				return rcUnknown, err
+			}
+			defer lock.release()
+		}
+		mydb, err := openDatabase(config)
+		if err != nil {
+			return rcUnknown, err
+		}
+		defer closeDB()
+		fileStore.db = mydb
+		if daemonRunning {
+			var count int
+			err = mydb.Get(&count, "select count(*) from check_definitions where filename = ?", filename)
+			if err != nil {
+				return rcUnknown, err
+			}
+			if count == 0 {
+				return rcUnknown, fmt.Errorf("check definition %s ist dem laufenden Daemon (PID %s) noch nicht bekannt, die Results werden nicht gespeichert", filename, pid)
+			}
+		} else {
+			err = fileStore.upsertCheckDefinition(filename, *checkDefinition)
+			if err != nil {
+				return rcUnknown, err
+			}
+		}
+		runId, err := recordCheckRun(makeCheckRun(filename, execution))
+		if err != nil {
+			return rcUnknown, err
+		}
+		for i := range results {
+			results[i].RunId = sql.NullInt64{Int64: runId, Valid: true}
+		}
+		results, err = ReplaceResults(filename, *checkDefinition, results)
+		if err != nil {
+			return rcUnknown, err
+		}
+		err = recordResourceUsage(filename, execution.ResourceUsage)
+		if err != nil {
+			return rcUnknown, err
+		}
+	}
+
+	content := make([][]string, len(results))
+	for i, result := range results {
+		content[i] = []string{coloredRcName(result.Rc), result.Name, result.Host, strings.ReplaceAll(result.Text, "\n", " "), result.Perfdata}
+	}
+	fmt.Println()
+	fmt.Println("--> Results")
+	printSimpleTable([]string{"State", "Name", "Host", "Text", "Perfdata"}, content)
+	fmt.Println()
+	fmt.Printf("--> Exit Code %d, Dauer %v, Timeout %v\n", execution.ExitCode, execution.Duration.Round(time.Millisecond), execution.TimedOut)
+	fmt.Printf("--> CPU User %v, CPU System %v, Max RSS %d KB\n", execution.ResourceUsage.UserCpu.Round(time.Millisecond), execution.ResourceUsage.SystemCpu.Round(time.Millisecond), execution.ResourceUsage.MaxRssKb)
+	if execution.OutputTruncated {
+		fmt.Printf("--> Output nach max_output_bytes %d %v\n", checkDefinition.MaxOutputBytes, color.YellowString("gekürzt"))
+	}
+	fmt.Println()
+	fmt.Println("--> Stdout")
+	fmt.Println(strings.TrimRight(execution.Stdout, "\n"))
+	fmt.Println()
+	fmt.Println("--> Stderr")
+	fmt.Println(strings.TrimRight(execution.Stderr, "\n"))
+	fmt.Println()
+	if store {
+		fmt.Printf("Results %v\n", color.GreenString("gespeichert"))
+	}
+	return worstRc(results), nil
+}
+
+func ResumeCheckHlc(config *AppConfig, check string) error {
+	_, err := openDatabase(config)
 	if err != nil {
-		slog.Error("Error initializing database", "err", err)
 		return err
 	}
 	defer closeDB()
 
-	store.db = mydb
-	err = store.ensureCheckDefinitionsInDatabase()
+	filename := checkDefinitionFilename(check)
+	err = resumeCheck(filename)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Check %s wird wieder %v\n", filename, color.GreenString("ausgeführt"))
+	return nil
+}
+
+func HistoryHlc(config *AppConfig, check string, name string, since string) error {
+	sinceDuration, err := parseDuration(since)
+	if err != nil {
+		return err
+	}
+	filename := ""
+	if check != "" {
+		filename = checkDefinitionFilename(check)
+	}
+
+	_, err = openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	stateChanges, err := loadStateChanges(filename, name, time.Now().Add(-sinceDuration))
+	if err != nil {
+		return err
+	}
+
+	content := make([][]string, len(stateChanges))
+	for i, stateChange := range stateChanges {
+		oldState := "-"
+		if stateChange.OldRc.Valid {
+			oldState = rcName(int(stateChange.OldRc.Int64))
+		}
+		newState := "REMOVED"
+		if stateChange.NewRc.Valid {
+			newState = rcName(int(stateChange.NewRc.Int64))
+		}
+		content[i] = []string{
+			time.Unix(stateChange.Timestamp, 0).Format(time.DateTime),
+			stateChange.Filename,
+			stateChange.Name,
+			stateChange.Host,
+			oldState,
+			newState,
+			stateChange.StateType,
+			strings.ReplaceAll(stateChange.Text, "\n", " "),
+		}
+	}
+	fmt.Println()
+	fmt.Printf("--> State Changes seit %s\n", time.Now().Add(-sinceDuration).Format(time.DateTime))
+	printSimpleTable([]string{"Zeit", "Check", "Name", "Host", "Alt", "Neu", "Type", "Text"}, content)
+	fmt.Println()
+	return nil
+}
+
+// StatusDaemonHlc checks like a nagios plugin, whether a daemon holds the lock file.
+// Returns rcOk if it is running, rcCritical otherwise.
+func StatusDaemonHlc(config *AppConfig) (int, error) {
+	running, pid, err := instanceLockHolder(config.LockFile())
+	if err != nil {
+		fmt.Printf("KAMONITU UNKNOWN - lock file %s kann nicht geprüft werden: %v\n", config.LockFile(), err)
+		return rcUnknown, nil
+	}
+	if !running {
+		fmt.Printf("KAMONITU CRITICAL - kamonitu läuft nicht (lock file %s nicht gesperrt)\n", config.LockFile())
+		return rcCritical, nil
+	}
+	fmt.Printf("KAMONITU OK - kamonitu läuft mit PID %s\n", pid)
+	return rcOk, nil
+}
+
+func StatusHlc(config *AppConfig) error {
+	_, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	results, err := loadResults()
+	if err != nil {
+		slog.Error("Error loading results", "err", err)
+		return err
+	}
+	acks, err := loadAcknowledgements()
 	if err != nil {
-		slog.Error("Error ensuring check definitions in database", "err", err)
 		return err
 	}
 
+	content := make([][]string, len(results))
+	for i, result := range results {
+		stateType := result.StateType
+		if result.StateType == stateTypeSoft {
+			stateType = fmt.Sprintf("%s (%d)", result.StateType, result.Attempt)
+		}
+		flapping := "no"
+		if result.Flapping {
+			flapping = fmt.Sprintf("yes (%d%%)", result.PercentStateChange)
+		}
+		downtime := "no"
+		if result.InDowntime {
+			downtime = "yes"
+		}
+		ack := ""
+		if a, ok := acks[acknowledgementKey{result.Filename, result.Name, result.Host}]; ok {
+			ack = a.Author + ": " + a.Comment
+			if a.Sticky {
+				ack += " (sticky)"
+			}
+			if a.ExpireTimestamp.Valid {
+				ack += " (bis " + time.Unix(a.ExpireTimestamp.Int64, 0).Format(time.DateTime) + ")"
+			}
+		}
+		content[i] = []string{
+			result.Filename,
+			result.Name,
+			result.Host,
+			rcName(result.Rc),
+			stateType,
+			flapping,
+			downtime,
+			ack,
+			strings.ReplaceAll(result.Text, "\n", " "),
+		}
+	}
+	fmt.Println()
+	fmt.Println("--> Results")
+	printSimpleTable([]string{"Check", "Name", "Host", "State", "Type", "Flapping", "Downtime", "Ack", "Text"}, content)
+	fmt.Println()
+
+	usages, err := loadResourceUsages()
+	if err != nil {
+		return err
+	}
+	content = make([][]string, len(usages))
+	for i, usage := range usages {
+		content[i] = []string{
+			usage.Filename,
+			time.Unix(usage.LastRun, 0).Format(time.DateTime),
+			(time.Duration(usage.UserCpuMs) * time.Millisecond).String(),
+			(time.Duration(usage.SystemCpuMs) * time.Millisecond).String(),
+			strconv.FormatInt(usage.MaxRssKb, 10),
+			(time.Duration(usage.TotalCpuMs) * time.Millisecond).String(),
+		}
+	}
+	fmt.Println("--> Ressourcen des letzten Laufs")
+	printSimpleTable([]string{"Check", "Letzter Lauf", "CPU User", "CPU System", "Max RSS KB", "CPU Gesamt"}, content)
+	fmt.Println()
+	return nil
+}
+
+func DowntimeAddHlc(config *AppConfig, downtime Downtime, start string, end string, duration string) error {
+	startTime := time.Now()
+	if start != "" {
+		var err error
+		startTime, err = parseTime(start)
+		if err != nil {
+			return err
+		}
+	}
+	var endTime time.Time
+	switch {
+	case end != "" && duration != "":
+		return fmt.Errorf("--end und --duration können nicht gemeinsam verwendet werden")
+	case end != "":
+		var err error
+		endTime, err = parseTime(end)
+		if err != nil {
+			return err
+		}
+	case duration != "":
+		d, err := parseDuration(duration)
+		if err != nil {
+			return err
+		}
+		endTime = startTime.Add(d)
+	default:
+		return fmt.Errorf("--end oder --duration muss angegeben werden")
+	}
+	if downtime.Filename != "" {
+		downtime.Filename = checkDefinitionFilename(downtime.Filename)
+	}
+	downtime.StartTimestamp = startTime.Unix()
+	downtime.EndTimestamp = endTime.Unix()
+	downtime.Author = currentUsername()
+
+	_, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	id, err := addDowntime(downtime)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Downtime %d von %s bis %s %v\n", id, startTime.Format(time.DateTime), endTime.Format(time.DateTime), color.GreenString("angelegt"))
+	return nil
+}
+
+func DowntimeListHlc(config *AppConfig, all bool) error {
+	_, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	downtimes, err := loadDowntimes(all)
+	if err != nil {
+		return err
+	}
+	content := make([][]string, len(downtimes))
+	for i, downtime := range downtimes {
+		content[i] = []string{
+			strconv.FormatInt(downtime.Id, 10),
+			time.Unix(downtime.StartTimestamp, 0).Format(time.DateTime),
+			time.Unix(downtime.EndTimestamp, 0).Format(time.DateTime),
+			downtime.Filename,
+			downtime.NamePattern,
+			downtime.Host,
+			downtime.Tag,
+			downtime.Author,
+			downtime.Comment,
+		}
+	}
+	fmt.Println()
+	fmt.Println("--> Downtimes")
+	printSimpleTable([]string{"Id", "Start", "Ende", "Check", "Name", "Host", "Tag", "Autor", "Kommentar"}, content)
+	fmt.Println()
+	return nil
+}
+
+func DowntimeRemoveHlc(config *AppConfig, id string) error {
+	downtimeId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("ungültige downtime id %q", id)
+	}
+	_, err = openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	err = removeDowntime(downtimeId)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Downtime %d %v\n", downtimeId, color.GreenString("entfernt"))
+	return nil
+}
+
+func AckHlc(config *AppConfig, check string, name string, host string, comment string, expire string, sticky bool, remove bool) error {
+	filename := checkDefinitionFilename(check)
+	ack := Acknowledgement{
+		Filename: filename,
+		Name:     name,
+		Host:     host,
+		Author:   currentUsername(),
+		Comment:  comment,
+		Sticky:   sticky,
+	}
+	if expire != "" {
+		d, err := parseDuration(expire)
+		if err != nil {
+			return err
+		}
+		ack.ExpireTimestamp = sql.NullInt64{Int64: time.Now().Add(d).Unix(), Valid: true}
+	}
+	if !remove && comment == "" {
+		return fmt.Errorf("--comment muss angegeben werden")
+	}
+
+	_, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	if remove {
+		err = removeAcknowledgement(filename, name, host)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Acknowledgement für %s %q %v\n", filename, name, color.GreenString("entfernt"))
+		return nil
+	}
+	err = acknowledge(ack)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Result %s %q %v\n", filename, name, color.GreenString("acknowledged"))
+	return nil
+}
+
+func RunsHlc(config *AppConfig, id string, check string, limit int) error {
+	_, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	if id != "" {
+		runId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ungültige run id %q", id)
+		}
+		return printCheckRun(runId)
+	}
+
+	filename := ""
+	if check != "" {
+		filename = checkDefinitionFilename(check)
+	}
+	runs, err := loadCheckRuns(filename, limit)
+	if err != nil {
+		return err
+	}
+	content := make([][]string, len(runs))
+	for i, run := range runs {
+		content[i] = []string{
+			strconv.FormatInt(run.Id, 10),
+			time.Unix(run.StartedAt, 0).Format(time.DateTime),
+			run.Filename,
+			(time.Duration(run.DurationMs) * time.Millisecond).String(),
+			strconv.Itoa(run.ExitCode),
+			run.Signal,
+			strconv.FormatBool(run.TimedOut),
+			run.Error,
+		}
+	}
+	fmt.Println()
+	fmt.Println("--> Runs")
+	printSimpleTable([]string{"Id", "Start", "Check", "Dauer", "Exit Code", "Signal", "Timeout", "Fehler"}, content)
+	fmt.Println()
+	return nil
+}
+
+// printCheckRun prints a single run with its output and the current results produced by it.
+func printCheckRun(id int64) error {
+	run, err := loadCheckRun(id)
+	if err != nil {
+		return err
+	}
+	results, err := loadResults()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("--> Run %d von %s\n", run.Id, run.Filename)
+	content := [][]string{
+		{"Start", time.Unix(run.StartedAt, 0).Format(time.DateTime)},
+		{"Dauer", (time.Duration(run.DurationMs) * time.Millisecond).String()},
+		{"Exit Code", strconv.Itoa(run.ExitCode)},
+		{"Signal", run.Signal},
+		{"Timeout", strconv.FormatBool(run.TimedOut)},
+		{"Fehler", run.Error},
+		{"Output gekürzt", strconv.FormatBool(run.OutputTruncated)},
+		{"CPU User", (time.Duration(run.UserCpuMs) * time.Millisecond).String()},
+		{"CPU System", (time.Duration(run.SystemCpuMs) * time.Millisecond).String()},
+		{"Max RSS KB", strconv.FormatInt(run.MaxRssKb, 10)},
+	}
+	printSimpleTable([]string{"Key", "Value"}, content)
+	fmt.Println()
+
+	content = [][]string{}
+	for _, result := range results {
+		if result.RunId.Valid && result.RunId.Int64 == run.Id {
+			content = append(content, []string{coloredRcName(result.Rc), result.Name, result.Host, strings.ReplaceAll(result.Text, "\n", " ")})
+		}
+	}
+	fmt.Println("--> Aktuelle Results aus diesem Run")
+	printSimpleTable([]string{"State", "Name", "Host", "Text"}, content)
+	fmt.Println()
+	fmt.Println("--> Stdout")
+	fmt.Println(strings.TrimRight(run.Stdout, "\n"))
+	fmt.Println()
+	fmt.Println("--> Stderr")
+	fmt.Println(strings.TrimRight(run.Stderr, "\n"))
+	fmt.Println()
 	return nil
 }
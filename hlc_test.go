@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestRunCheckHlcStore(t *testing.T) {
+	config := makeTestConfigDir(t, map[string]string{"swap.ini": "check_command = echo swap low; exit 1\n"})
+	config.VarDir = t.TempDir()
+	countRows := func(table string) int {
+		_, err := initDB(config.DbFile())
+		assert.NoError(t, err)
+		defer closeDB()
+		var count int
+		assert.NoError(t, db.Get(&count, "select count(*) from "+table+" where filename = 'swap.ini'"))
+		return count
+	}
+
+	rc, err := RunCheckHlc(config, "missing", false)
+	assert.Error(t, err)
+	assert.Equal(t, rcUnknown, rc, "a check definition that can not be loaded is UNKNOWN")
+
+	// the daemon does not know check definitions outside of check_definitions
+	outside := t.TempDir() + "/swap.ini"
+	assert.NoError(t, os.WriteFile(outside, []byte("check_command = echo swap low; exit 1\n"), 0644))
+	rc, err = RunCheckHlc(config, outside, false)
+	assert.NoError(t, err)
+	assert.Equal(t, rcWarning, rc)
+	rc, err = RunCheckHlc(config, outside, true)
+	assert.ErrorContains(t, err, "--store ist nur für Check Definitionen in "+config.CheckDefinitionsDir+" möglich")
+	assert.Equal(t, rcUnknown, rc)
+	assert.NoFileExists(t, config.DbFile())
+
+	// a running daemon has not loaded swap.ini yet
+	lock, err := acquireInstanceLock(config.LockFile())
+	assert.NoError(t, err)
+	rc, err = RunCheckHlc(config, "swap", true)
+	assert.ErrorContains(t, err, "check definition swap.ini ist dem laufenden Daemon")
+	assert.Equal(t, rcUnknown, rc)
+	assert.Equal(t, 0, countRows("check_definitions"))
+	lock.release()
+
+	// without a daemon the check definition is written under the lock
+	rc, err = RunCheckHlc(config, "swap", true)
+	assert.NoError(t, err)
+	assert.Equal(t, rcWarning, rc)
+	running, _, err := instanceLockHolder(config.LockFile())
+	assert.NoError(t, err)
+	assert.False(t, running, "the lock is released after the run")
+	assert.Equal(t, 1, countRows("check_definitions"))
+	assert.Equal(t, 1, countRows("results"))
+	assert.Equal(t, 1, countRows("check_runs"))
+
+	// a running daemon knowing swap.ini gets the results
+	lock, err = acquireInstanceLock(config.LockFile())
+	assert.NoError(t, err)
+	defer lock.release()
+	rc, err = RunCheckHlc(config, "swap", true)
+	assert.NoError(t, err)
+	assert.Equal(t, rcWarning, rc)
+	assert.Equal(t, 2, countRows("check_runs"))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	hookFailure = "failure"
+	hookTimeout = "timeout"
+)
+
+// hookTag is the tag of the kamonitu internal result that reports a failed hook of a check.
+func hookTag(filename string) string {
+	return "Hook " + filename
+}
+
+// runHooks runs execute_on_timeout if the check timed out, or execute_on_failure if a result is not OK.
+// Hooks only run, if a result that is neither flapping, in downtime nor acknowledged changed into a non-OK HARD state.
+// The context of the check is passed to the hook via environment variables, see hookEnvironment.
+// A failing hook is recorded as kamonitu internal result, which is removed after the next successful hook.
+// If ctx is cancelled, the hook is killed and its result is not recorded.
+func runHooks(ctx context.Context, filename string, checkDefinition CheckDefinition, execution ExecutionResult, results []Result) {
+	hook, command := hookFailure, checkDefinition.ExecuteOnFailure
+	if execution.TimedOut {
+		hook, command = hookTimeout, checkDefinition.ExecuteOnTimeout
+	}
+	if command == "" || !hasHardProblemChange(results) {
+		return
+	}
+
+	slog.Info("Running hook", "filename", filename, "hook", hook, "command", command)
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), hookEnvironment(filename, hook, execution, results)...)
+	// the hook runs as run_as_user and run_as_group like the check, so the owner of a check can not gain the rights of kamonitu
+	credential, err := checkCredential(checkDefinition)
+	if err != nil {
+		recordHookResult(filename, hook, fmt.Sprintf("Hook execute_on_%s of %s could not be executed: %v", hook, filename, err))
+		return
+	}
+	if credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+	hookExecution := executeCommand(ctx, cmd, time.Duration(checkDefinition.HookTimeoutSeconds)*time.Second, resourceLimits{})
+
+	if hookExecution.Aborted {
+		slog.Warn("Hook aborted at shutdown", "filename", filename, "hook", hook)
+		return
+	}
+
+	var message string
+	switch {
+	case hookExecution.Err != nil:
+		message = fmt.Sprintf("Hook execute_on_%s of %s could not be executed: %v", hook, filename, hookExecution.Err)
+	case hookExecution.TimedOut:
+		message = fmt.Sprintf("Hook execute_on_%s of %s timed out after %d seconds", hook, filename, checkDefinition.HookTimeoutSeconds)
+	case hookExecution.ExitCode != 0:
+		message = fmt.Sprintf("Hook execute_on_%s of %s failed with exit code %d: %s", hook, filename, hookExecution.ExitCode, strings.TrimSpace(hookExecution.Stderr))
+	}
+
+	recordHookResult(filename, hook, message)
+}
+
+// recordHookResult records the message of a failed hook as kamonitu internal result, or removes it when message is empty.
+func recordHookResult(filename string, hook string, message string) {
+	errors := []string{}
+	if message != "" {
+		slog.Warn("Hook failed", "filename", filename, "hook", hook, "message", message)
+		errors = append(errors, message)
+	}
+	err := ReplaceKamonituResults(errors, hookTag(filename))
+	if err != nil {
+		slog.Error("Error replacing kamonitu results", "err", err)
+	}
+}
+
+// hasHardProblemChange returns true if a result that is neither flapping, in downtime nor acknowledged changed into a non-OK HARD state.
+func hasHardProblemChange(results []Result) bool {
+	for _, result := range results {
+		if result.HardStateChange && result.Rc != rcOk && !result.Flapping && !result.InDowntime && !result.Acknowledged {
+			return true
+		}
+	}
+	return false
+}
+
+// hookEnvironment returns the environment variables with the context of the check for a hook.
+// Names, texts and perfdata are those of the results that are not OK, one per line.
+func hookEnvironment(filename string, hook string, execution ExecutionResult, results []Result) []string {
+	var names, texts, perfdata []string
+	for _, result := range results {
+		if result.Rc == rcOk {
+			continue
+		}
+		names = append(names, result.Name)
+		texts = append(texts, result.Text)
+		perfdata = append(perfdata, result.Perfdata)
+	}
+
+	return []string{
+		"KAMONITU_HOOK=" + hook,
+		"KAMONITU_CHECK_FILENAME=" + filename,
+		"KAMONITU_RC=" + strconv.Itoa(worstRc(results)),
+		"KAMONITU_EXIT_CODE=" + strconv.Itoa(execution.ExitCode),
+		"KAMONITU_TIMED_OUT=" + strconv.FormatBool(execution.TimedOut),
+		"KAMONITU_DURATION_MS=" + strconv.FormatInt(execution.Duration.Milliseconds(), 10),
+		"KAMONITU_RESULT_NAMES=" + strings.Join(names, "\n"),
+		"KAMONITU_TEXT=" + strings.Join(texts, "\n"),
+		"KAMONITU_PERFDATA=" + strings.Join(perfdata, "\n"),
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	makeTestDatabase(t)
+	envFile := t.TempDir() + "/env"
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{
+		"execute_on_failure": "env -0 | grep -z ^KAMONITU_ | sort -z | tr '\\0' ';' > " + envFile,
+		"execute_on_timeout": "echo timeout hook broken >&2; exit 1",
+	})
+	countHookResults := func() int {
+		var count int
+		assert.NoError(t, db.Get(&count, "select count(*) from results where tags = ?", hookTag("swap.ini")))
+		return count
+	}
+
+	// No hook for OK results
+	results := []Result{{Filename: "swap.ini", Rc: rcOk, Name: "Swap"}}
+	runHooks(context.Background(), "swap.ini", checkDefinition, ExecutionResult{}, results)
+	assert.NoFileExists(t, envFile)
+
+	results = []Result{
+		{Filename: "swap.ini", Rc: rcOk, Name: "Port 1"},
+		{Filename: "swap.ini", Rc: rcWarning, Name: "Port 2", Text: "Port ist Down", Perfdata: "port2=0", StateType: stateTypeHard},
+		{Filename: "swap.ini", Rc: rcCritical, Name: "Port 3", Text: "Port ist weg", StateType: stateTypeSoft},
+	}
+	// No hook without a HARD state change
+	runHooks(context.Background(), "swap.ini", checkDefinition, ExecutionResult{}, results)
+	assert.NoFileExists(t, envFile)
+
+	results[1].HardStateChange = true
+	runHooks(context.Background(), "swap.ini", checkDefinition, ExecutionResult{ExitCode: 0, Duration: 1500 * time.Millisecond}, results)
+	content, err := os.ReadFile(envFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "KAMONITU_CHECK_FILENAME=swap.ini;KAMONITU_DURATION_MS=1500;KAMONITU_EXIT_CODE=0;KAMONITU_HOOK=failure;"+
+		"KAMONITU_PERFDATA=port2=0\n;KAMONITU_RC=2;KAMONITU_RESULT_NAMES=Port 2\nPort 3;KAMONITU_TEXT=Port ist Down\nPort ist weg;KAMONITU_TIMED_OUT=false;", string(content))
+	assert.Equal(t, 0, countHookResults())
+
+	// A failing hook is recorded as kamonitu internal result
+	results = []Result{{Filename: "swap.ini", Rc: rcUnknown, Name: "swap", Text: "Check timed out after 60 seconds", StateType: stateTypeHard, HardStateChange: true}}
+	runHooks(context.Background(), "swap.ini", checkDefinition, ExecutionResult{TimedOut: true}, results)
+	assert.Equal(t, 1, countHookResults())
+	var text string
+	assert.NoError(t, db.Get(&text, "select text from results where tags = ?", hookTag("swap.ini")))
+	assert.Equal(t, "Hook execute_on_timeout of swap.ini failed with exit code 1: timeout hook broken", text)
+}
+
+func TestRunHooksAsUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("dropping privileges needs root")
+	}
+	makeTestDatabase(t)
+	nobody, err := user.Lookup("nobody")
+	assert.NoError(t, err)
+	// the uid of the hook is reported via stderr of the failing hook
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{
+		"execute_on_failure": "id -u >&2; exit 1",
+		"run_as_user":        "nobody",
+	})
+
+	results := []Result{{Filename: "swap.ini", Rc: rcCritical, Name: "Swap", StateType: stateTypeHard, HardStateChange: true}}
+	runHooks(context.Background(), "swap.ini", checkDefinition, ExecutionResult{}, results)
+	var text string
+	assert.NoError(t, db.Get(&text, "select text from results where tags = ?", hookTag("swap.ini")))
+	assert.Equal(t, "Hook execute_on_failure of swap.ini failed with exit code 1: "+nobody.Uid, text, "the hook runs as run_as_user of the check")
+}
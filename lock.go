@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// instanceLock is the exclusive flock on the lock file in VarDir, held by the running daemon.
+// The lock file contains the PID of the daemon. The lock is released by the kernel, when the process exits.
+type instanceLock struct {
+	file *os.File
+}
+
+// acquireInstanceLock locks the lock file exclusively and writes the own PID into it.
+// If another process holds the lock, the error names its PID.
+func acquireInstanceLock(path string) (*instanceLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("lock file %s kann nicht geöffnet werden: %v", path, err)
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+		return nil, fmt.Errorf("kamonitu läuft bereits mit PID %s (lock file %s)", holderPid(path), path)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock file %s kann nicht gesperrt werden: %v", path, err)
+	}
+
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("PID kann nicht in lock file %s geschrieben werden: %v", path, err)
+	}
+	slog.Info("Acquired instance lock", "path", path, "pid", os.Getpid())
+	return &instanceLock{file: file}, nil
+}
+
+// release empties the lock file and releases the lock.
+func (l *instanceLock) release() {
+	_ = l.file.Truncate(0)
+	err := l.file.Close()
+	if err != nil {
+		slog.Error("Error releasing instance lock", "path", l.file.Name(), "err", err)
+	}
+}
+
+// instanceLockHolder returns whether the lock file is locked by a running daemon and its PID.
+func instanceLockHolder(path string) (bool, string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	defer file.Close()
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return true, holderPid(path), nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return false, "", syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+// holderPid returns the PID in the lock file, "unbekannt" if it is not written yet.
+func holderPid(path string) string {
+	content, err := os.ReadFile(path)
+	pid := strings.TrimSpace(string(content))
+	if err != nil || pid == "" {
+		return "unbekannt"
+	}
+	return pid
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestInstanceLock(t *testing.T) {
+	path := t.TempDir() + "/kamonitu.pid"
+	running, _, err := instanceLockHolder(path)
+	assert.NoError(t, err)
+	assert.False(t, running, "no lock file")
+
+	lock, err := acquireInstanceLock(path)
+	assert.NoError(t, err)
+	running, pid, err := instanceLockHolder(path)
+	assert.NoError(t, err)
+	assert.True(t, running)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), pid)
+
+	_, err = acquireInstanceLock(path)
+	assert.ErrorContains(t, err, "kamonitu läuft bereits mit PID "+strconv.Itoa(os.Getpid()))
+
+	lock.release()
+	running, _, err = instanceLockHolder(path)
+	assert.NoError(t, err)
+	assert.False(t, running, "released lock")
+
+	lock, err = acquireInstanceLock(path)
+	assert.NoError(t, err, "a released lock can be acquired again")
+	lock.release()
+}
@@ -108,6 +108,155 @@ func main() {
 	}
 	rootCmd.AddCommand(RunCmd)
 
+	/* run-check */
+	var runCheckStore bool
+	RunCheckCmd := &cobra.Command{
+		Use:   "run-check <file>",
+		Short: "Führt eine Check Definition einmalig aus und beendet sich mit dem schlechtesten Returncode",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rc, err := RunCheckHlc(appConfig, args[0], runCheckStore)
+			if err != nil {
+				// like a failing check, an error is UNKNOWN and not mistaken for a WARNING
+				slog.Error("Command execution failed.", "error", err)
+				fmt.Printf("Fehler: %v\n", err)
+			}
+			os.Exit(rc)
+			return nil
+		},
+	}
+	RunCheckCmd.Flags().BoolVar(&runCheckStore, "store", false, "Speichert die Results in der Datenbank")
+	rootCmd.AddCommand(RunCheckCmd)
+
+	/* runs */
+	var runsCheck string
+	var runsLimit int
+	RunsCmd := &cobra.Command{
+		Use:   "runs [id]",
+		Short: "Zeigt die letzten Läufe der Checks oder einen Lauf mit Stdout und Stderr",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id := ""
+			if len(args) == 1 {
+				id = args[0]
+			}
+			return RunsHlc(appConfig, id, runsCheck, runsLimit)
+		},
+	}
+	RunsCmd.Flags().StringVar(&runsCheck, "check", "", "Nur Läufe dieser Check Definition")
+	RunsCmd.Flags().IntVar(&runsLimit, "limit", 20, "Anzahl der Läufe")
+	rootCmd.AddCommand(RunsCmd)
+
+	/* resume-check */
+	ResumeCheckCmd := &cobra.Command{
+		Use:   "resume-check <file>",
+		Short: "Setzt die Timeouts eines suspendierten Checks zurück",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ResumeCheckHlc(appConfig, args[0])
+		},
+	}
+	rootCmd.AddCommand(ResumeCheckCmd)
+
+	/* status */
+	var statusDaemon bool
+	StatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Zeigt die aktuellen Results",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if statusDaemon {
+				rc, err := StatusDaemonHlc(appConfig)
+				if err != nil {
+					return err
+				}
+				os.Exit(rc)
+			}
+			return StatusHlc(appConfig)
+		},
+	}
+	StatusCmd.Flags().BoolVar(&statusDaemon, "daemon", false, "Prüft wie ein Nagios Plugin, ob der Daemon läuft")
+	rootCmd.AddCommand(StatusCmd)
+
+	/* downtime */
+	DowntimeCmd := &cobra.Command{
+		Use:   "downtime",
+		Short: "Verwaltet Downtimes (Wartungsfenster)",
+	}
+	var downtime Downtime
+	var downtimeStart, downtimeEnd, downtimeDuration string
+	DowntimeAddCmd := &cobra.Command{
+		Use:   "add",
+		Short: "Legt eine Downtime für einen Check, Result Namen, Host oder Tag an",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return DowntimeAddHlc(appConfig, downtime, downtimeStart, downtimeEnd, downtimeDuration)
+		},
+	}
+	DowntimeAddCmd.Flags().StringVar(&downtime.Filename, "check", "", "Check Definition, z.B. swap.ini")
+	DowntimeAddCmd.Flags().StringVar(&downtime.NamePattern, "name", "", "Result Name oder Pattern, z.B. 'Port *'")
+	DowntimeAddCmd.Flags().StringVar(&downtime.Host, "host", "", "Host der Results")
+	DowntimeAddCmd.Flags().StringVar(&downtime.Tag, "tag", "", "Tag der Results, z.B. network")
+	DowntimeAddCmd.Flags().StringVar(&downtime.Comment, "comment", "", "Kommentar")
+	DowntimeAddCmd.Flags().StringVar(&downtimeStart, "start", "", "Start, z.B. '2025-01-30 14:00' (Default jetzt)")
+	DowntimeAddCmd.Flags().StringVar(&downtimeEnd, "end", "", "Ende, z.B. '2025-01-30 16:00'")
+	DowntimeAddCmd.Flags().StringVar(&downtimeDuration, "duration", "", "Dauer ab Start, z.B. 2h oder 1d")
+	DowntimeCmd.AddCommand(DowntimeAddCmd)
+
+	var downtimeListAll bool
+	DowntimeListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Zeigt die Downtimes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return DowntimeListHlc(appConfig, downtimeListAll)
+		},
+	}
+	DowntimeListCmd.Flags().BoolVar(&downtimeListAll, "all", false, "Auch beendete Downtimes anzeigen")
+	DowntimeCmd.AddCommand(DowntimeListCmd)
+
+	DowntimeRemoveCmd := &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Entfernt eine Downtime",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return DowntimeRemoveHlc(appConfig, args[0])
+		},
+	}
+	DowntimeCmd.AddCommand(DowntimeRemoveCmd)
+	rootCmd.AddCommand(DowntimeCmd)
+
+	/* ack */
+	var ackHost, ackComment, ackExpire string
+	var ackSticky, ackRemove bool
+	AckCmd := &cobra.Command{
+		Use:   "ack <file> <name>",
+		Short: "Acknowledged ein nicht OK Result",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return AckHlc(appConfig, args[0], args[1], ackHost, ackComment, ackExpire, ackSticky, ackRemove)
+		},
+	}
+	AckCmd.Flags().StringVar(&ackHost, "host", "", "Host des Results")
+	AckCmd.Flags().StringVar(&ackComment, "comment", "", "Kommentar")
+	AckCmd.Flags().StringVar(&ackExpire, "expire", "", "Ablauf des Acknowledgements, z.B. 4h oder 1d")
+	AckCmd.Flags().BoolVar(&ackSticky, "sticky", false, "Acknowledgement bleibt bestehen, auch wenn das Result wieder OK ist")
+	AckCmd.Flags().BoolVar(&ackRemove, "remove", false, "Entfernt das Acknowledgement")
+	rootCmd.AddCommand(AckCmd)
+
+	/* history */
+	var historyCheck, historyName, historySince string
+	HistoryCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Zeigt die State Changes der Results",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return HistoryHlc(appConfig, historyCheck, historyName, historySince)
+		},
+	}
+	HistoryCmd.Flags().StringVar(&historyCheck, "check", "", "Nur State Changes dieser Check Definition, z.B. swap.ini")
+	HistoryCmd.Flags().StringVar(&historyName, "name", "", "Nur State Changes dieses Results, z.B. Swap")
+	HistoryCmd.Flags().StringVar(&historySince, "since", "24h", "Zeitraum, z.B. 30m, 24h oder 7d")
+	rootCmd.AddCommand(HistoryCmd)
+
 	wipCmd := &cobra.Command{
 		Use:   "wip",
 		Short: "WIP",
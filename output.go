@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"golang.org/x/sys/unix"
+	"strconv"
+	"strings"
+)
+
+const (
+	rcOk       = 0
+	rcWarning  = 1
+	rcCritical = 2
+	rcUnknown  = 3
+
+	outputFormatNagios   = "nagios"
+	outputFormatKamonitu = "kamonitu"
+	outputFormatAuto     = "auto"
+
+	// kamonituOutputMaxFields is the number of fields of a line in the Kamonitu plugin output: rc, name, text, perfdata, host and tags
+	kamonituOutputMaxFields = 6
+)
+
+var rcNames = map[int]string{rcOk: "OK", rcWarning: "WARNING", rcCritical: "CRITICAL", rcUnknown: "UNKNOWN"}
+
+// rcName returns the name of a returncode, e.g. OK or CRITICAL.
+func rcName(rc int) string {
+	if name, ok := rcNames[rc]; ok {
+		return name
+	}
+	return strconv.Itoa(rc)
+}
+
+// coloredRcName returns the name of a returncode in the color of its state. The names are padded to the same
+// length, so colored cells of a column have the same length and a table stays aligned.
+func coloredRcName(rc int) string {
+	name := fmt.Sprintf("%-8s", rcName(rc))
+	switch rc {
+	case rcOk:
+		return color.GreenString(name)
+	case rcWarning:
+		return color.YellowString(name)
+	case rcCritical:
+		return color.RedString(name)
+	default:
+		return color.MagentaString(name)
+	}
+}
+
+// parseKamonituOutput parses the stdout of a check in the Kamonitu plugin output format, as described in the readme.
+// Every line is a single result in the format '|rc|name|text|perfdata|host|tags'. Empty lines are skipped.
+// A malformed line does not abort the parsing, it is returned as UNKNOWN result that describes the error.
+func parseKamonituOutput(filename string, output string) []Result {
+	results := make([]Result, 0)
+	for i, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		result, err := parseKamonituOutputLine(line)
+		if err != nil {
+			result = Result{
+				Rc:   rcUnknown,
+				Name: fmt.Sprintf("Invalid output line %d", i+1),
+				Text: fmt.Sprintf("%v: %q", err, line),
+			}
+		}
+		result.Filename = filename
+		results = append(results, result)
+	}
+	return results
+}
+
+// parseKamonituOutputLine parses a single line in the format '|rc|name|text|perfdata|host|tags'.
+func parseKamonituOutputLine(line string) (Result, error) {
+	if !strings.HasPrefix(line, "|") {
+		return Result{}, fmt.Errorf("line does not start with '|'")
+	}
+	fields := strings.Split(line[1:], "|")
+	if len(fields) > kamonituOutputMaxFields {
+		return Result{}, fmt.Errorf("too many fields: %d, allowed are %d", len(fields), kamonituOutputMaxFields)
+	}
+	// Pad optional fields
+	for len(fields) < kamonituOutputMaxFields {
+		fields = append(fields, "")
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	rc, err := strconv.Atoi(fields[0])
+	if err != nil || rc < rcOk || rc > rcUnknown {
+		return Result{}, fmt.Errorf("invalid returncode %q, must be one of 0, 1, 2, 3", fields[0])
+	}
+	if fields[1] == "" {
+		return Result{}, fmt.Errorf("missing name")
+	}
+
+	return Result{
+		Rc:       rc,
+		Name:     fields[1],
+		Text:     fields[2],
+		Perfdata: fields[3],
+		Host:     fields[4],
+		Tags:     fields[5],
+	}, nil
+}
+
+// parseNagiosOutput parses the stdout of a classic Nagios plugin into a single result named after the check file.
+// The exit code of the plugin is the returncode. The first line is 'TEXT|PERFDATA', the following lines are long output.
+// The first '|' in the long output starts additional perfdata, which may continue on the following lines:
+//
+//	TEXT | PERFDATA
+//	LONG TEXT LINE 1
+//	LONG TEXT LINE 2 | PERFDATA LINE 2
+//	PERFDATA LINE 3
+func parseNagiosOutput(filename string, exitCode int, output string) Result {
+	rc := exitCode
+	if rc < rcOk || rc > rcUnknown {
+		rc = rcUnknown
+	}
+
+	lines := strings.Split(strings.TrimRight(output, "\r\n"), "\n")
+	text, perfdata, _ := strings.Cut(lines[0], "|")
+	texts := []string{strings.TrimSpace(text)}
+	perfdatas := []string{strings.TrimSpace(perfdata)}
+
+	inPerfdata := false
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if inPerfdata {
+			perfdatas = append(perfdatas, strings.TrimSpace(line))
+			continue
+		}
+		text, perfdata, found := strings.Cut(line, "|")
+		texts = append(texts, strings.TrimRight(text, " "))
+		if found {
+			perfdatas = append(perfdatas, strings.TrimSpace(perfdata))
+			inPerfdata = true
+		}
+	}
+
+	return Result{
+		Filename: filename,
+		Rc:       rc,
+		Name:     checkName(filename),
+		Text:     strings.TrimSpace(strings.Join(texts, "\n")),
+		Perfdata: strings.Join(strings.Fields(strings.Join(perfdatas, " ")), " "),
+	}
+}
+
+// isKamonituOutput returns true if the first non-empty line of the output starts with '|'.
+// It decides between Kamonitu and Nagios plugin output for output_format 'auto'.
+func isKamonituOutput(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			return strings.HasPrefix(line, "|")
+		}
+	}
+	return false
+}
+
+// checkName is the name of a check definition without the .ini extension.
+// It is used as result name, if a check does not return results on its own.
+func checkName(filename string) string {
+	return strings.TrimSuffix(filename, ".ini")
+}
+
+// resultsFromExecution turns the execution of a check into rows for the results table.
+func resultsFromExecution(filename string, checkDefinition CheckDefinition, execution ExecutionResult) []Result {
+	if execution.TimedOut {
+		return []Result{{Filename: filename, Rc: rcUnknown, Name: checkName(filename), Text: fmt.Sprintf("Check timed out after %d seconds", checkDefinition.TimeoutSeconds)}}
+	}
+	if execution.Err != nil {
+		return []Result{{Filename: filename, Rc: rcUnknown, Name: checkName(filename), Text: fmt.Sprintf("Check could not be executed: %v", execution.Err)}}
+	}
+	if execution.Signal != 0 {
+		return []Result{{Filename: filename, Rc: rcUnknown, Name: checkName(filename), Text: fmt.Sprintf("Check was killed by signal %s", unix.SignalName(execution.Signal))}}
+	}
+
+	if strings.TrimSpace(execution.Stdout) == "" {
+		return []Result{{Filename: filename, Rc: rcUnknown, Name: checkName(filename), Text: fmt.Sprintf("Check returned no output (exit code %d): %s", execution.ExitCode, strings.TrimSpace(execution.Stderr))}}
+	}
+
+	outputFormat := checkDefinition.OutputFormat
+	if outputFormat == outputFormatAuto {
+		outputFormat = outputFormatNagios
+		if isKamonituOutput(execution.Stdout) {
+			outputFormat = outputFormatKamonitu
+		}
+	}
+	if outputFormat == outputFormatNagios {
+		return []Result{parseNagiosOutput(filename, execution.ExitCode, execution.Stdout)}
+	}
+	return parseKamonituOutput(filename, execution.Stdout)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"syscall"
+	"testing"
+)
+
+func TestParseKamonituOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Result
+	}{
+		{
+			name:   "single line with text",
+			output: "|0|Swap|Swap OK - 95% free\n",
+			want: []Result{
+				{Filename: "swap.ini", Rc: 0, Name: "Swap", Text: "Swap OK - 95% free"},
+			},
+		},
+		{
+			name:   "all fields and empty fields",
+			output: "|1|Filesystem /home| /home ist zu 90% voll|/home=90,80,95\n\n|0|Port 3||port3=1554,235,334,224|myswitch.home.lab|network,homelab\r\n",
+			want: []Result{
+				{Filename: "swap.ini", Rc: 1, Name: "Filesystem /home", Text: "/home ist zu 90% voll", Perfdata: "/home=90,80,95"},
+				{Filename: "swap.ini", Rc: 0, Name: "Port 3", Perfdata: "port3=1554,235,334,224", Host: "myswitch.home.lab", Tags: "network,homelab"},
+			},
+		},
+		{
+			name:   "empty output",
+			output: "\n  \n",
+			want:   []Result{},
+		},
+		{
+			name:   "malformed lines become unknown results",
+			output: "|5|Swap|text\n|0||text\n|0|Swap|text|perf|host|tags|extra\nSwap OK\n|x|Swap\n|2|Swap",
+			want: []Result{
+				{Filename: "swap.ini", Rc: rcUnknown, Name: "Invalid output line 1", Text: `invalid returncode "5", must be one of 0, 1, 2, 3: "|5|Swap|text"`},
+				{Filename: "swap.ini", Rc: rcUnknown, Name: "Invalid output line 2", Text: `missing name: "|0||text"`},
+				{Filename: "swap.ini", Rc: rcUnknown, Name: "Invalid output line 3", Text: `too many fields: 7, allowed are 6: "|0|Swap|text|perf|host|tags|extra"`},
+				{Filename: "swap.ini", Rc: rcUnknown, Name: "Invalid output line 4", Text: `line does not start with '|': "Swap OK"`},
+				{Filename: "swap.ini", Rc: rcUnknown, Name: "Invalid output line 5", Text: `invalid returncode "x", must be one of 0, 1, 2, 3: "|x|Swap"`},
+				{Filename: "swap.ini", Rc: 2, Name: "Swap"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseKamonituOutput("swap.ini", tt.output)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseNagiosOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+		output   string
+		want     Result
+	}{
+		{
+			name:     "text only",
+			exitCode: 0,
+			output:   "SWAP OK - 95% free\n",
+			want:     Result{Filename: "swap.ini", Rc: 0, Name: "swap", Text: "SWAP OK - 95% free"},
+		},
+		{
+			name:     "text and perfdata",
+			exitCode: 1,
+			output:   "SWAP WARNING - 15% free | swap=15%;20;10\n",
+			want:     Result{Filename: "swap.ini", Rc: 1, Name: "swap", Text: "SWAP WARNING - 15% free", Perfdata: "swap=15%;20;10"},
+		},
+		{
+			name:     "long output with trailing perfdata lines",
+			exitCode: 2,
+			output:   "DISK CRITICAL - /home full | /=20%\n/ 20% used\n/home 99% used | /home=99%\n/var=40%\n/tmp=1%\n",
+			want:     Result{Filename: "swap.ini", Rc: 2, Name: "swap", Text: "DISK CRITICAL - /home full\n/ 20% used\n/home 99% used", Perfdata: "/=20% /home=99% /var=40% /tmp=1%"},
+		},
+		{
+			name:     "long output without perfdata",
+			exitCode: 0,
+			output:   "OK\nline 1\nline 2\n",
+			want:     Result{Filename: "swap.ini", Rc: 0, Name: "swap", Text: "OK\nline 1\nline 2"},
+		},
+		{
+			name:     "invalid exit code is unknown",
+			exitCode: 127,
+			output:   "sh: check_swap: not found",
+			want:     Result{Filename: "swap.ini", Rc: rcUnknown, Name: "swap", Text: "sh: check_swap: not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseNagiosOutput("swap.ini", tt.exitCode, tt.output)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResultsFromExecution(t *testing.T) {
+	checkDefinition := CheckDefinition{TimeoutSeconds: 10, OutputFormat: outputFormatAuto}
+
+	results := resultsFromExecution("swap.ini", checkDefinition, ExecutionResult{TimedOut: true})
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: rcUnknown, Name: "swap", Text: "Check timed out after 10 seconds"}}, results)
+
+	results = resultsFromExecution("swap.ini", checkDefinition, ExecutionResult{ExitCode: 1, Stderr: "no swap\n"})
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: rcUnknown, Name: "swap", Text: "Check returned no output (exit code 1): no swap"}}, results)
+
+	results = resultsFromExecution("swap.ini", checkDefinition, ExecutionResult{ExitCode: -1, Signal: syscall.SIGXCPU, Stdout: "|0|Swap|OK\n"})
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: rcUnknown, Name: "swap", Text: "Check was killed by signal SIGXCPU"}}, results)
+
+	results = resultsFromExecution("swap.ini", checkDefinition, ExecutionResult{Stdout: "|0|Swap|OK\n"})
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: rcOk, Name: "Swap", Text: "OK"}}, results)
+
+	results = resultsFromExecution("swap.ini", checkDefinition, ExecutionResult{ExitCode: 1, Stdout: "SWAP WARNING|swap=15%\n"})
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: rcWarning, Name: "swap", Text: "SWAP WARNING", Perfdata: "swap=15%"}}, results)
+
+	checkDefinition.OutputFormat = outputFormatNagios
+	results = resultsFromExecution("swap.ini", checkDefinition, ExecutionResult{ExitCode: 2, Stdout: "|0|Swap|OK\n"})
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: rcCritical, Name: "swap", Perfdata: "0|Swap|OK"}}, results)
+
+	checkDefinition.OutputFormat = outputFormatKamonitu
+	results = resultsFromExecution("swap.ini", checkDefinition, ExecutionResult{Stdout: "SWAP OK\n"})
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: rcUnknown, Name: "Invalid output line 1", Text: `line does not start with '|': "SWAP OK"`}}, results)
+}
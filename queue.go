@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// queuedCheck is a due check waiting for a worker.
+type queuedCheck struct {
+	filename        string
+	checkDefinition CheckDefinition
+	dueAt           time.Time
+}
+
+// checkQueue holds the due checks for the workers of the Scheduler.
+// A check is either pending or running, never both and never twice. The most overdue check is taken first.
+type checkQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[string]queuedCheck
+	running map[string]bool
+	closed  bool
+}
+
+func makeCheckQueue() *checkQueue {
+	q := &checkQueue{
+		pending: make(map[string]queuedCheck),
+		running: make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a due check. Returns false if the check is already pending or running, or the queue is closed.
+func (q *checkQueue) push(check queuedCheck) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || q.running[check.filename] {
+		return false
+	}
+	if _, ok := q.pending[check.filename]; ok {
+		return false
+	}
+	q.pending[check.filename] = check
+	q.cond.Signal()
+	return true
+}
+
+// pop blocks until a check is pending and returns the most overdue one, which is marked as running.
+// Returns false if the queue is closed.
+func (q *checkQueue) pop() (queuedCheck, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return queuedCheck{}, false
+	}
+
+	var next queuedCheck
+	first := true
+	for _, check := range q.pending {
+		if first || check.dueAt.Before(next.dueAt) || (check.dueAt.Equal(next.dueAt) && check.filename < next.filename) {
+			next = check
+			first = false
+		}
+	}
+	delete(q.pending, next.filename)
+	q.running[next.filename] = true
+	return next, true
+}
+
+// done marks a running check as finished.
+func (q *checkQueue) done(filename string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, filename)
+}
+
+// oldestPending returns the due time of the most overdue pending check and the number of pending and running checks.
+func (q *checkQueue) oldestPending() (dueAt time.Time, pending int, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, check := range q.pending {
+		if dueAt.IsZero() || check.dueAt.Before(dueAt) {
+			dueAt = check.dueAt
+		}
+	}
+	return dueAt, len(q.pending), len(q.running)
+}
+
+// close drops all pending checks and wakes up all waiting workers.
+func (q *checkQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.pending = make(map[string]queuedCheck)
+	q.cond.Broadcast()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCheckQueue(t *testing.T) {
+	q := makeCheckQueue()
+	now := time.Now()
+	assert.True(t, q.push(queuedCheck{filename: "a.ini", dueAt: now.Add(-10 * time.Second)}))
+	assert.True(t, q.push(queuedCheck{filename: "b.ini", dueAt: now.Add(-60 * time.Second)}))
+	assert.True(t, q.push(queuedCheck{filename: "c.ini", dueAt: now.Add(-30 * time.Second)}))
+	assert.False(t, q.push(queuedCheck{filename: "a.ini", dueAt: now}), "already pending")
+
+	dueAt, pending, running := q.oldestPending()
+	assert.Equal(t, now.Add(-60*time.Second), dueAt)
+	assert.Equal(t, 3, pending)
+	assert.Equal(t, 0, running)
+
+	// The most overdue check is taken first
+	check, ok := q.pop()
+	assert.True(t, ok)
+	assert.Equal(t, "b.ini", check.filename)
+	check, ok = q.pop()
+	assert.True(t, ok)
+	assert.Equal(t, "c.ini", check.filename)
+	assert.False(t, q.push(queuedCheck{filename: "c.ini", dueAt: now}), "already running")
+
+	q.done("c.ini")
+	assert.True(t, q.push(queuedCheck{filename: "c.ini", dueAt: now}))
+	_, pending, running = q.oldestPending()
+	assert.Equal(t, 2, pending)
+	assert.Equal(t, 1, running)
+
+	// close wakes up waiting workers and drops pending checks
+	q.close()
+	_, ok = q.pop()
+	assert.False(t, ok)
+	assert.False(t, q.push(queuedCheck{filename: "d.ini", dueAt: now}))
+}
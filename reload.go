@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// loadCheckDefinitionsTag is the tag of the kamonitu internal results for errors in check definitions
+const loadCheckDefinitionsTag = "LoadCheckDefinitionsFromDisk"
+
+// errorMessages returns the messages of the errors in a multierror, or of err itself.
+func errorMessages(err error) []string {
+	messages := []string{}
+	if err == nil {
+		return messages
+	}
+	if merr, ok := err.(*multierror.Error); ok {
+		for _, individualErr := range merr.Errors {
+			messages = append(messages, individualErr.Error())
+		}
+		return messages
+	}
+	return append(messages, err.Error())
+}
+
+// keepLastGoodDefinitions keeps the definitions of previous for files that still exist, but could not be loaded
+// into c, e.g. because their new version fails validation. A time period of a kept definition, that was removed
+// from timeperiods.ini, is kept as well. Returns a message for each kept definition and time period.
+func (c *CheckDefinitionFileStore) keepLastGoodDefinitions(previous *CheckDefinitionFileStore) []string {
+	messages := []string{}
+	for filename, checkDefinition := range previous.CheckDefinitions {
+		if _, ok := c.CheckDefinitions[filename]; ok {
+			continue
+		}
+		if _, err := os.Stat(c.directory + "/" + filename); err != nil {
+			continue
+		}
+		slog.Warn("Check definition could not be reloaded - keeping last good definition", "filename", filename)
+		c.CheckDefinitions[filename] = checkDefinition
+		c.CheckDefinitionSources[filename] = previous.CheckDefinitionSources[filename]
+		messages = append(messages, fmt.Sprintf("check definition %q could not be reloaded, the last good definition is used", filename))
+
+		period := checkDefinition.CheckPeriod
+		if period == "" || c.TimePeriods[period] != nil {
+			continue
+		}
+		slog.Warn("Time period of kept check definition removed - keeping last good time period", "filename", filename, "checkPeriod", period)
+		c.TimePeriods[period] = previous.TimePeriods[period]
+		messages = append(messages, fmt.Sprintf("check_period %q of check definition %q is no longer defined in %s, the last good time period is used", period, filename, timePeriodsFileName))
+	}
+	return messages
+}
+
+// recordLoad remembers the outcome of loading the check definitions for the self monitoring.
+func (c *CheckDefinitionFileStore) recordLoad(ok bool, now time.Time) {
+	if ok {
+		c.lastSuccessfulLoad = now
+		c.failingSince = time.Time{}
+		return
+	}
+	if c.failingSince.IsZero() {
+		c.failingSince = now
+	}
+}
+
+// keepAllDefinitions reports that the check definitions could not be reloaded at all and leaves the store unchanged.
+func (c *CheckDefinitionFileStore) keepAllDefinitions(err error) error {
+	slog.Error("Error reloading check definitions - keeping all definitions", "err", err)
+	_ = ReplaceKamonituResults([]string{fmt.Sprintf("check definitions could not be reloaded, the last good definitions are used: %v", err)}, loadCheckDefinitionsTag)
+	c.recordLoad(false, time.Now())
+	return err
+}
+
+// reloadCheckDefinitions loads the check definitions, their defaults and the time periods from disk again
+// and applies them to the store and the database. A check definition whose new version can not be loaded
+// keeps its last good definition. If the defaults, the time periods or the directory of the check definitions
+// can not be loaded, or no check definition is left, nothing is changed.
+// All errors are reported as kamonitu internal results.
+func (c *CheckDefinitionFileStore) reloadCheckDefinitions(config AppConfig) error {
+	slog.Info("Reloading check definitions")
+	reloaded, err := makeCheckDefinitionFileStore(config)
+	if err != nil {
+		return c.keepAllDefinitions(err)
+	}
+	err = reloaded.LoadCheckDefinitionsFromDisk()
+	if _, perFile := err.(*multierror.Error); err != nil && !perFile {
+		return c.keepAllDefinitions(err)
+	}
+	messages := errorMessages(err)
+	messages = append(messages, reloaded.keepLastGoodDefinitions(c)...)
+	if len(reloaded.CheckDefinitions) == 0 {
+		return c.keepAllDefinitions(fmt.Errorf("no check definitions found in %q", reloaded.directory))
+	}
+
+	reloaded.db = c.db
+	err = reloaded.ensureCheckDefinitionsInDatabase()
+	if err != nil {
+		return err
+	}
+	c.CheckDefinitions = reloaded.CheckDefinitions
+	c.CheckDefinitionSources = reloaded.CheckDefinitionSources
+	c.TimePeriods = reloaded.TimePeriods
+	c.recordLoad(len(messages) == 0, time.Now())
+	slog.Info("Check definitions reloaded", "count", len(c.CheckDefinitions), "errors", len(messages))
+
+	return ReplaceKamonituResults(messages, loadCheckDefinitionsTag)
+}
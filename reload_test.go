@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+// makeTestConfigDir creates a config directory with the check definitions files in check_definitions.
+func makeTestConfigDir(t *testing.T, files map[string]string) *AppConfig {
+	d := t.TempDir()
+	config := &AppConfig{ConfigDir: d, CheckDefinitionsDir: d + "/check_definitions"}
+	assert.NoError(t, os.Mkdir(config.CheckDefinitionsDir, 0755))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/"+name, []byte(content), 0644))
+	}
+	return config
+}
+
+func TestReloadCheckDefinitions(t *testing.T) {
+	makeTestDatabase(t)
+	config := makeTestConfigDir(t, map[string]string{
+		"swap.ini": "check_command = check_swap\n",
+		"cpu.ini":  "check_command = check_cpu\n",
+		"disk.ini": "check_command = check_disk\n",
+	})
+	store, err := makeCheckDefinitionFileStore(*config)
+	assert.NoError(t, err)
+	assert.NoError(t, store.LoadCheckDefinitionsFromDisk())
+	store.db = db
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	// swap.ini changes, cpu.ini becomes invalid, disk.ini is removed and load.ini is added
+	assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/swap.ini", []byte("check_command = check_swap -w 10%\n"), 0644))
+	assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/cpu.ini", []byte("check_command = check_cpu\ntimeout_seconds = nix\n"), 0644))
+	assert.NoError(t, os.Remove(config.CheckDefinitionsDir+"/disk.ini"))
+	assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/load.ini", []byte("check_command = check_load\n"), 0644))
+	assert.NoError(t, store.reloadCheckDefinitions(*config))
+
+	assert.Len(t, store.CheckDefinitions, 3)
+	assert.Equal(t, "check_swap -w 10%", store.CheckDefinitions["swap.ini"].CheckCommand)
+	assert.Equal(t, "check_cpu", store.CheckDefinitions["cpu.ini"].CheckCommand, "last good definition")
+	assert.Equal(t, "check_load", store.CheckDefinitions["load.ini"].CheckCommand)
+	var filenames []string
+	assert.NoError(t, db.Select(&filenames, "select filename from check_definitions where filename != ? order by filename", kamonituInternalFilename))
+	assert.Equal(t, []string{"cpu.ini", "load.ini", "swap.ini"}, filenames)
+
+	results, err := loadResults()
+	assert.NoError(t, err)
+	texts := []string{}
+	for _, result := range results {
+		if result.Filename == kamonituInternalFilename && result.Tags == loadCheckDefinitionsTag {
+			texts = append(texts, result.Text)
+		}
+	}
+	assert.Len(t, texts, 2, "the load error and the kept definition of cpu.ini are reported")
+
+	// fixing cpu.ini removes the errors
+	assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/cpu.ini", []byte("check_command = check_cpu -w 90%\n"), 0644))
+	assert.NoError(t, store.reloadCheckDefinitions(*config))
+	assert.Equal(t, "check_cpu -w 90%", store.CheckDefinitions["cpu.ini"].CheckCommand)
+	results, err = loadResults()
+	assert.NoError(t, err)
+	for _, result := range results {
+		assert.NotEqual(t, loadCheckDefinitionsTag, result.Tags)
+	}
+
+	// broken defaults keep all definitions
+	assert.NoError(t, os.WriteFile(config.ConfigDir+"/"+checkDefinitionDefaultsFileName, []byte("no ini line\n"), 0644))
+	assert.Error(t, store.reloadCheckDefinitions(*config))
+	assert.Len(t, store.CheckDefinitions, 3)
+}
+
+func TestReloadWithoutCheckDefinitionsDir(t *testing.T) {
+	makeTestDatabase(t)
+	config := makeTestConfigDir(t, map[string]string{
+		"swap.ini": "check_command = check_swap\n",
+		"cpu.ini":  "check_command = check_cpu\n",
+	})
+	store, err := makeCheckDefinitionFileStore(*config)
+	assert.NoError(t, err)
+	assert.NoError(t, store.LoadCheckDefinitionsFromDisk())
+	store.db = db
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+	_, err = ReplaceResults("swap.ini", store.CheckDefinitions["swap.ini"], []Result{{Rc: rcOk, Name: "Swap"}})
+	assert.NoError(t, err)
+	countRows := func() int {
+		var count int
+		assert.NoError(t, db.Get(&count, "select count(*) from check_definitions where filename != ?", kamonituInternalFilename))
+		return count
+	}
+
+	// a renamed directory keeps all definitions, their rows and results
+	assert.NoError(t, os.Rename(config.CheckDefinitionsDir, config.CheckDefinitionsDir+".old"))
+	assert.Error(t, store.reloadCheckDefinitions(*config))
+	assert.Len(t, store.CheckDefinitions, 2)
+	assert.Equal(t, 2, countRows())
+	results, err := loadResults()
+	assert.NoError(t, err)
+	names := []string{}
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+	assert.Contains(t, names, "Swap")
+	assert.False(t, store.failingSince.IsZero(), "the failed reload is reported by the self monitoring")
+
+	// an empty directory keeps all definitions as well
+	assert.NoError(t, os.Mkdir(config.CheckDefinitionsDir, 0755))
+	assert.Error(t, store.reloadCheckDefinitions(*config))
+	assert.Len(t, store.CheckDefinitions, 2)
+	assert.Equal(t, 2, countRows())
+}
+
+func TestReloadKeepsTimePeriodOfKeptDefinition(t *testing.T) {
+	makeTestDatabase(t)
+	config := makeTestConfigDir(t, map[string]string{
+		"backup.ini": "check_command = check_backup\ncheck_period = workhours\n",
+	})
+	assert.NoError(t, os.WriteFile(config.ConfigDir+"/"+timePeriodsFileName, []byte("workhours = mon-fri 08:00-18:00\n"), 0644))
+	store, err := makeCheckDefinitionFileStore(*config)
+	assert.NoError(t, err)
+	assert.NoError(t, store.LoadCheckDefinitionsFromDisk())
+	store.db = db
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	// workhours is removed, so backup.ini fails to load and keeps its last good definition and time period
+	assert.NoError(t, os.WriteFile(config.ConfigDir+"/"+timePeriodsFileName, []byte("nights = * 22:00-06:00\n"), 0644))
+	assert.NoError(t, store.reloadCheckDefinitions(*config))
+	assert.Equal(t, "workhours", store.CheckDefinitions["backup.ini"].CheckPeriod)
+	assert.NotNil(t, store.TimePeriods["workhours"])
+	assert.Equal(t, "mon-fri 08:00-18:00", store.TimePeriods["workhours"].Definition)
+
+	results, err := loadResults()
+	assert.NoError(t, err)
+	texts := []string{}
+	for _, result := range results {
+		if result.Tags == loadCheckDefinitionsTag {
+			texts = append(texts, result.Text)
+		}
+	}
+	assert.Len(t, texts, 3, "the load error, the kept definition and the kept time period are reported")
+}
+
+func TestConfigWatcher(t *testing.T) {
+	config := makeTestConfigDir(t, nil)
+	watcher, err := makeConfigWatcher(config)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	reasons := make(chan string, 10)
+	done := make(chan struct{})
+	go func() {
+		watcher.run(ctx, func(reason string) { reasons <- reason })
+		close(done)
+	}()
+
+	assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/.swap.ini.swp", []byte("x"), 0644))
+	assert.NoError(t, os.WriteFile(config.ConfigDir+"/kamonitu.ini", []byte("x"), 0644))
+	assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/swap.ini", []byte("check_command = true\n"), 0644))
+	assert.NoError(t, os.WriteFile(config.CheckDefinitionsDir+"/swap.ini", []byte("check_command = false\n"), 0644))
+	select {
+	case reason := <-reasons:
+		assert.Contains(t, reason, "swap.ini")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after a changed check definition")
+	}
+	select {
+	case reason := <-reasons:
+		t.Errorf("changes within the settle time should be reloaded once, got %q", reason)
+	case <-time.After(2 * watcherSettleTime):
+	}
+
+	assert.NoError(t, os.WriteFile(config.ConfigDir+"/"+timePeriodsFileName, []byte("workhours = mon-fri 08:00-18:00\n"), 0644))
+	select {
+	case reason := <-reasons:
+		assert.Contains(t, reason, timePeriodsFileName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after changed time periods")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher did not stop")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// resourceLimits are the limits of a check process. A zero value means unlimited.
+type resourceLimits struct {
+	memoryBytes uint64 // RLIMIT_AS, the address space of each process
+	cpuSeconds  uint64 // RLIMIT_CPU, the cpu time of each process
+	outputBytes int    // the number of captured bytes of stdout and stderr each
+}
+
+// checkResourceLimits returns the limits of max_memory_mb, max_cpu_seconds and max_output_bytes of a check definition.
+func checkResourceLimits(checkDefinition CheckDefinition) resourceLimits {
+	return resourceLimits{
+		memoryBytes: uint64(checkDefinition.MaxMemoryMb) * 1024 * 1024,
+		cpuSeconds:  uint64(checkDefinition.MaxCpuSeconds),
+		outputBytes: checkDefinition.MaxOutputBytes,
+	}
+}
+
+// wrap changes cmd into a shell that sets the limits and then execs the original command. So the limits apply
+// from the first instruction of the command on and are inherited by every process it forks, e.g. the processes
+// of a pipeline. If a limit can not be set, the shell exits with 125 without running the command.
+func (l resourceLimits) wrap(cmd *exec.Cmd) {
+	if (l.memoryBytes == 0 && l.cpuSeconds == 0) || cmd.Err != nil {
+		return
+	}
+	script := ""
+	if l.memoryBytes > 0 {
+		script += fmt.Sprintf("ulimit -v %d || exit 125; ", l.memoryBytes/1024)
+	}
+	if l.cpuSeconds > 0 {
+		// SIGXCPU at the soft limit, SIGKILL a second later at the hard limit
+		script += fmt.Sprintf("ulimit -S -t %d && ulimit -H -t %d || exit 125; ", l.cpuSeconds, l.cpuSeconds+1)
+	}
+	script += `exec "$@"`
+	cmd.Args = append([]string{"/bin/sh", "-c", script, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
+
+// limitedWriter writes at most limit bytes to w and discards the rest, so the process is not blocked.
+// A limit of zero means unlimited.
+type limitedWriter struct {
+	w         io.Writer
+	limit     int
+	written   int
+	truncated bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.written+len(p) > l.limit {
+		l.truncated = true
+		_, err := l.w.Write(p[:l.limit-l.written])
+		l.written = l.limit
+		return len(p), err
+	}
+	n, err := l.w.Write(p)
+	l.written += n
+	return n, err
+}
+
+// resourceUsage is the cpu time and memory used by a check process and its children.
+type resourceUsage struct {
+	UserCpu   time.Duration
+	SystemCpu time.Duration
+	MaxRssKb  int64
+}
+
+// resourceUsageOf returns the resource usage from the rusage of a finished process.
+func resourceUsageOf(sysUsage any) resourceUsage {
+	rusage, ok := sysUsage.(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return resourceUsage{}
+	}
+	return resourceUsage{
+		UserCpu:   time.Duration(rusage.Utime.Nano()),
+		SystemCpu: time.Duration(rusage.Stime.Nano()),
+		MaxRssKb:  rusage.Maxrss, // kilobytes on linux
+	}
+}
+
+// checkResourceUsage is the resource usage of the last run of a check definition.
+type checkResourceUsage struct {
+	Filename    string `db:"filename"`
+	UserCpuMs   int64  `db:"last_user_cpu_ms"`
+	SystemCpuMs int64  `db:"last_system_cpu_ms"`
+	MaxRssKb    int64  `db:"last_max_rss_kb"`
+	TotalCpuMs  int64  `db:"total_cpu_ms"`
+	LastRun     int64  `db:"last_run_timestamp"`
+}
+
+// recordResourceUsage stores the resource usage of the last run of the check definition and adds its cpu time to the total.
+func recordResourceUsage(filename string, usage resourceUsage) error {
+	_, err := db.Exec(`update check_definitions
+			set last_user_cpu_ms = ?, last_system_cpu_ms = ?, last_max_rss_kb = ?, total_cpu_ms = total_cpu_ms + ?
+			where filename = ?`,
+		usage.UserCpu.Milliseconds(), usage.SystemCpu.Milliseconds(), usage.MaxRssKb, (usage.UserCpu + usage.SystemCpu).Milliseconds(), filename)
+	if err != nil {
+		slog.Error("Error updating resource usage", "filename", filename, "err", err)
+		return err
+	}
+	return nil
+}
+
+// loadResourceUsages returns the resource usage of all check definitions that ran, the most cpu time of the last run first.
+func loadResourceUsages() ([]checkResourceUsage, error) {
+	usages := []checkResourceUsage{}
+	err := db.Select(&usages, `select filename, last_user_cpu_ms, last_system_cpu_ms, last_max_rss_kb, total_cpu_ms, last_run_timestamp
+			from check_definitions
+			where filename != ? and last_run_timestamp > 0
+			order by last_user_cpu_ms + last_system_cpu_ms desc, filename`, kamonituInternalFilename)
+	if err != nil {
+		slog.Error("Error selecting resource usage", "err", err)
+		return nil, err
+	}
+	return usages, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLimitedWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	w := &limitedWriter{w: &buffer, limit: 10}
+	n, err := w.Write([]byte("12345"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.False(t, w.truncated)
+	n, err = w.Write([]byte("6789012345"))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n, "the whole input is consumed, so the process is not blocked")
+	assert.True(t, w.truncated)
+	_, err = w.Write([]byte("more"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1234567890", buffer.String())
+
+	buffer.Reset()
+	w = &limitedWriter{w: &buffer}
+	_, err = w.Write(bytes.Repeat([]byte("x"), 100000))
+	assert.NoError(t, err)
+	assert.False(t, w.truncated, "zero limit is unlimited")
+	assert.Equal(t, 100000, buffer.Len())
+}
+
+func TestExecuteCheckResourceLimits(t *testing.T) {
+	result := executeCheck(context.Background(), CheckDefinition{CheckCommand: "head -c 5000 /dev/zero", TimeoutSeconds: 10, MaxOutputBytes: 1024})
+	assert.NoError(t, result.Err)
+	assert.True(t, result.OutputTruncated)
+	assert.Len(t, result.Stdout, 1024)
+
+	result = executeCheck(context.Background(), CheckDefinition{CheckCommand: "while :; do :; done", TimeoutSeconds: 10, MaxCpuSeconds: 1})
+	assert.NoError(t, result.Err)
+	assert.False(t, result.TimedOut, "killed by the cpu limit before the timeout")
+	assert.Equal(t, -1, result.ExitCode)
+	assert.Contains(t, []syscall.Signal{syscall.SIGXCPU, syscall.SIGKILL}, result.Signal)
+	assert.GreaterOrEqual(t, result.ResourceUsage.UserCpu+result.ResourceUsage.SystemCpu, 900*time.Millisecond)
+
+	result = executeCheck(context.Background(), CheckDefinition{CheckCommand: `x=$(head -c 50000000 /dev/zero | tr "\0" a); echo done`, TimeoutSeconds: 10, MaxMemoryMb: 32})
+	assert.NotEqual(t, 0, result.ExitCode)
+	assert.NotContains(t, result.Stdout, "done")
+
+	// the limit applies to the processes of a pipeline forked by the shell as well
+	result = executeCheck(context.Background(), CheckDefinition{CheckCommand: "true | dd if=/dev/zero of=/dev/null bs=50M count=1 2>/dev/null && echo done", TimeoutSeconds: 10, MaxMemoryMb: 32})
+	assert.NotEqual(t, 0, result.ExitCode)
+	assert.NotContains(t, result.Stdout, "done")
+	result = executeCheck(context.Background(), CheckDefinition{CheckCommand: "true | dd if=/dev/zero of=/dev/null bs=50M count=1 2>/dev/null && echo done", TimeoutSeconds: 10})
+	assert.Equal(t, "done\n", result.Stdout, "the pipeline succeeds without limit")
+
+	result = executeCheck(context.Background(), CheckDefinition{CheckCommand: "echo $0 $1", Shell: "false", TimeoutSeconds: 10, MaxMemoryMb: 32, MaxCpuSeconds: 5})
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "$0 $1\n", result.Stdout, "the arguments of a command without shell are passed unchanged")
+
+	result = executeCheck(context.Background(), CheckDefinition{CheckCommand: "true", TimeoutSeconds: 10})
+	assert.Greater(t, result.ResourceUsage.MaxRssKb, int64(0))
+}
+
+func TestRecordResourceUsage(t *testing.T) {
+	makeTestDatabase(t)
+	store := CheckDefinitionFileStore{
+		db: db,
+		CheckDefinitions: map[string]CheckDefinition{
+			"swap.ini": makeTestCheckDefinition(t, nil),
+			"cpu.ini":  makeTestCheckDefinition(t, nil),
+		},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+	assert.NoError(t, store.updateLastRunTimestamp("swap.ini", time.Now()))
+
+	usage := resourceUsage{UserCpu: 1500 * time.Millisecond, SystemCpu: 500 * time.Millisecond, MaxRssKb: 4096}
+	assert.NoError(t, recordResourceUsage("swap.ini", usage))
+	assert.NoError(t, recordResourceUsage("swap.ini", usage))
+
+	usages, err := loadResourceUsages()
+	assert.NoError(t, err)
+	assert.Len(t, usages, 1, "checks that never ran are skipped")
+	assert.Equal(t, int64(1500), usages[0].UserCpuMs)
+	assert.Equal(t, int64(500), usages[0].SystemCpuMs)
+	assert.Equal(t, int64(4096), usages[0].MaxRssKb)
+	assert.Equal(t, int64(4000), usages[0].TotalCpuMs)
+}
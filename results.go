@@ -1,8 +1,247 @@
 package main
 
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"log/slog"
+	"time"
+)
+
+const (
+	stateTypeSoft = "SOFT"
+	stateTypeHard = "HARD"
+)
+
+// Result is a single row of the results table.
+type Result struct {
+	Filename   string `db:"filename"`
+	Rc         int    `db:"rc"`
+	Name       string `db:"name"`
+	Text       string `db:"text"`
+	Perfdata   string `db:"perfdata"`
+	Host       string `db:"host"`
+	Tags       string `db:"tags"`
+	StateType  string `db:"state_type"`
+	Attempt    int    `db:"attempt"`
+	LastHardRc int    `db:"last_hard_rc"`
+
+	StateHistory       string `db:"state_history"`
+	PercentStateChange int    `db:"percent_state_change"`
+	Flapping           bool   `db:"flapping"`
+	InDowntime         bool   `db:"in_downtime"`
+
+	// RunId references the row of check_runs of the run that produced the result
+	RunId sql.NullInt64 `db:"run_id"`
+
+	// HardStateChange is set by ReplaceResults, if the result changed into another HARD state
+	HardStateChange bool `db:"-"`
+	// Acknowledged is set by ReplaceResults, if the result is acknowledged by an operator
+	Acknowledged bool `db:"-"`
+}
+
+// resultKey identifies a service within the results of a check definition.
+type resultKey struct {
+	name string
+	host string
+}
+
+// rcSeverity orders the returncodes from best to worst: OK, WARNING, UNKNOWN, CRITICAL.
+var rcSeverity = map[int]int{rcOk: 0, rcWarning: 1, rcUnknown: 2, rcCritical: 3}
+
+// worstRc returns the worst returncode of the results, OK if there are no results.
+func worstRc(results []Result) int {
+	worst := rcOk
+	for _, result := range results {
+		if rcSeverity[result.Rc] > rcSeverity[worst] {
+			worst = result.Rc
+		}
+	}
+	return worst
+}
+
+// ReplaceResults atomically replaces all results of the check definition filename with the given results.
+// The state type and attempt of each result are derived from the previous result of the same service, see applyStateTypes,
+// as is flapping, see applyFlapDetection. Results matching an active downtime are marked as in downtime,
+// acknowledged results as acknowledged, see applyAcknowledgements. A changed rc of a service is recorded in the table state_changes.
+// Returns the results with their state type, attempt and hard state change.
+func ReplaceResults(filename string, checkDefinition CheckDefinition, results []Result) ([]Result, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	previousResults := []Result{}
+	err = tx.Select(&previousResults, "SELECT name, coalesce(host, '') as host, rc, state_type, attempt, last_hard_rc, state_history, flapping FROM results WHERE filename = ?", filename)
+	if err != nil {
+		return nil, err
+	}
+	results = applyStateTypes(previousResults, results, checkDefinition.MaxCheckAttempts)
+	results = applyFlapDetection(previousResults, results, checkDefinition)
+
+	downtimes, err := activeDowntimes(tx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	results = applyDowntimes(downtimes, results)
+
+	results, err = applyAcknowledgements(tx, filename, results)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM results WHERE filename = ?", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordStateChanges(tx, filename, previousResults, results)
+	if err != nil {
+		return nil, err
+	}
+
+	softState := false
+	for _, result := range results {
+
+		_, err = tx.Exec("INSERT INTO results (filename, rc, name, text, perfdata, host, tags, state_type, attempt, last_hard_rc, state_history, percent_state_change, flapping, in_downtime, run_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			filename, result.Rc, result.Name, nullIfEmpty(result.Text), nullIfEmpty(result.Perfdata), nullIfEmpty(result.Host), nullIfEmpty(result.Tags),
+			result.StateType, result.Attempt, result.LastHardRc, result.StateHistory, result.PercentStateChange, result.Flapping, result.InDowntime, result.RunId)
+		if err != nil {
+			return nil, err
+		}
+		softState = softState || result.StateType == stateTypeSoft
+	}
+
+	// Checks with SOFT states are rechecked with retry_interval_seconds
+	_, err = tx.Exec("UPDATE check_definitions SET soft_state = ? WHERE filename = ?", softState, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, tx.Commit()
+}
+
+// recordStateChanges stores the changes of rc or state type between the previous and the new results of a check
+// in state_changes. A previous result, that is no longer reported, is stored with new_rc null.
+// Old state changes are removed by pruneStateChanges.
+func recordStateChanges(tx *sqlx.Tx, filename string, previousResults []Result, results []Result) error {
+	insert := func(name string, host string, oldRc any, newRc any, stateType string, text string) error {
+		_, err := tx.Exec("INSERT INTO state_changes (filename, name, host, old_rc, new_rc, state_type, text, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			filename, name, nullIfEmpty(host), oldRc, newRc, stateType, nullIfEmpty(text), time.Now().Unix())
+		return err
+	}
+
+	previous := resultsByKey(previousResults)
+	current := resultsByKey(results)
+	for _, result := range results {
+		prev, ok := previous[resultKey{result.Name, result.Host}]
+		if ok && prev.Rc == result.Rc && prev.StateType == result.StateType {
+			continue
+		}
+		var oldRc any
+		if ok {
+			oldRc = prev.Rc
+		}
+		err := insert(result.Name, result.Host, oldRc, result.Rc, result.StateType, result.Text)
+		if err != nil {
+			return err
+		}
+	}
+	for _, prev := range previousResults {
+		if _, ok := current[resultKey{prev.Name, prev.Host}]; ok {
+			continue
+		}
+		err := insert(prev.Name, prev.Host, prev.Rc, nil, prev.StateType, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneStateChanges removes the state changes older than retentionDays.
+func pruneStateChanges(retentionDays int, now time.Time) error {
+	res, err := db.Exec("DELETE FROM state_changes WHERE timestamp < ?", now.AddDate(0, 0, -retentionDays).Unix())
+	if err != nil {
+		slog.Error("Error deleting old state changes", "retentionDays", retentionDays, "err", err)
+		return err
+	}
+	if removed, _ := res.RowsAffected(); removed > 0 {
+		slog.Debug("Old state changes removed", "count", removed, "retentionDays", retentionDays)
+	}
+	return nil
+}
+
+// applyStateTypes sets state type, attempt and last hard rc of the results based on the previous results of the same service.
+// OK is always a HARD state. A non-OK result is a SOFT state, until it failed maxCheckAttempts consecutive times.
+// Once a service is in a non-OK HARD state, it stays HARD until it recovers, even if the non-OK rc changes.
+func applyStateTypes(previousResults []Result, results []Result, maxCheckAttempts int) []Result {
+	previous := resultsByKey(previousResults)
+
+	for i := range results {
+		result := &results[i]
+		prev, hasPrev := previous[resultKey{result.Name, result.Host}]
+		lastHardRc := rcOk
+		if hasPrev {
+			lastHardRc = prev.LastHardRc
+		}
+
+		switch {
+		case result.Rc == rcOk:
+			result.StateType, result.Attempt = stateTypeHard, 1
+		case hasPrev && prev.Rc != rcOk && prev.StateType == stateTypeHard:
+			result.StateType, result.Attempt = stateTypeHard, maxCheckAttempts
+		case hasPrev && prev.Rc != rcOk:
+			result.Attempt = min(prev.Attempt+1, maxCheckAttempts)
+		default:
+			result.Attempt = 1
+		}
+		if result.Rc != rcOk && result.StateType != stateTypeHard {
+			result.StateType = stateTypeSoft
+			if result.Attempt >= maxCheckAttempts {
+				result.StateType = stateTypeHard
+			}
+		}
+
+		result.LastHardRc = lastHardRc
+		if result.StateType == stateTypeHard {
+			result.HardStateChange = result.Rc != lastHardRc
+			result.LastHardRc = result.Rc
+		}
+	}
+	return results
+}
+
+// loadResults returns all current results, ordered by filename and name.
+func loadResults() ([]Result, error) {
+	results := []Result{}
+	err := db.Select(&results, `SELECT filename, rc, name, coalesce(text, '') as text, coalesce(perfdata, '') as perfdata, coalesce(host, '') as host, coalesce(tags, '') as tags, 
+       		state_type, attempt, last_hard_rc, state_history, percent_state_change, flapping, in_downtime, run_id 
+			FROM results ORDER BY filename, name, host`)
+	return results, err
+}
+
+// resultsByKey returns the results by name and host.
+func resultsByKey(results []Result) map[resultKey]Result {
+	m := make(map[resultKey]Result, len(results))
+	for _, result := range results {
+		m[resultKey{result.Name, result.Host}] = result
+	}
+	return m
+}
+
 // ReplaceKamonituResults deletes all existing kamonitu results with the given tag and inserts new results in the database.
 // The results are marked as warnings.
 func ReplaceKamonituResults(errors []string, tag string) error {
+	results := make([]Result, len(errors))
+	for i, myerror := range errors {
+		results[i] = Result{Rc: rcWarning, Name: "Kamonitu Internal", Text: myerror}
+	}
+	return ReplaceKamonituResultRows(results, tag)
+}
+
+// ReplaceKamonituResultRows deletes all existing kamonitu results with the given tag and inserts the given results.
+func ReplaceKamonituResultRows(results []Result, tag string) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -10,13 +249,14 @@ func ReplaceKamonituResults(errors []string, tag string) error {
 	defer tx.Rollback()
 
 	// Delete existing kamonitu results
-	_, err = tx.Exec("DELETE FROM results WHERE filename = ? and tags = ?", "kamonitu", tag)
+	_, err = tx.Exec("DELETE FROM results WHERE filename = ? and tags = ?", kamonituInternalFilename, tag)
 	if err != nil {
 		return err
 	}
 
-	for _, myerror := range errors {
-		_, err = tx.Exec("INSERT INTO results (filename, rc, name, text, tags) VALUES ('kamonitu', 1, 'Kamonitu Internal', ?, ?)", myerror, tag)
+	for _, result := range results {
+		_, err = tx.Exec("INSERT INTO results (filename, rc, name, text, perfdata, tags) VALUES (?, ?, ?, ?, ?, ?)",
+			kamonituInternalFilename, result.Rc, result.Name, nullIfEmpty(result.Text), nullIfEmpty(result.Perfdata), tag)
 		if err != nil {
 			return err
 		}
@@ -24,3 +264,11 @@ func ReplaceKamonituResults(errors []string, tag string) error {
 
 	return tx.Commit()
 }
+
+// nullIfEmpty stores empty optional fields as NULL.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApplyStateTypes(t *testing.T) {
+	run := func(previous []Result, rc int) Result {
+		return applyStateTypes(previous, []Result{{Name: "Swap", Rc: rc}}, 3)[0]
+	}
+
+	// New OK service
+	result := run(nil, rcOk)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcOk, StateType: stateTypeHard, Attempt: 1, LastHardRc: rcOk}, result)
+
+	// Failures are SOFT until max_check_attempts is reached
+	result = run([]Result{result}, rcWarning)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcWarning, StateType: stateTypeSoft, Attempt: 1, LastHardRc: rcOk}, result)
+	result = run([]Result{result}, rcCritical)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcCritical, StateType: stateTypeSoft, Attempt: 2, LastHardRc: rcOk}, result)
+	result = run([]Result{result}, rcCritical)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcCritical, StateType: stateTypeHard, Attempt: 3, LastHardRc: rcCritical, HardStateChange: true}, result)
+
+	// Stays HARD, a changed rc is a hard state change
+	result = run([]Result{result}, rcCritical)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcCritical, StateType: stateTypeHard, Attempt: 3, LastHardRc: rcCritical}, result)
+	result = run([]Result{result}, rcWarning)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcWarning, StateType: stateTypeHard, Attempt: 3, LastHardRc: rcWarning, HardStateChange: true}, result)
+
+	// Recovery
+	result = run([]Result{result}, rcOk)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcOk, StateType: stateTypeHard, Attempt: 1, LastHardRc: rcOk, HardStateChange: true}, result)
+
+	// A SOFT failure that recovers is no hard state change
+	result = run([]Result{result}, rcCritical)
+	assert.Equal(t, stateTypeSoft, result.StateType)
+	result = run([]Result{result}, rcOk)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcOk, StateType: stateTypeHard, Attempt: 1, LastHardRc: rcOk}, result)
+
+	// With max_check_attempts 1, the first failure is HARD
+	results := applyStateTypes(nil, []Result{{Name: "Swap", Rc: rcCritical}}, 1)
+	assert.Equal(t, Result{Name: "Swap", Rc: rcCritical, StateType: stateTypeHard, Attempt: 1, LastHardRc: rcCritical, HardStateChange: true}, results[0])
+}
+
+func TestReplaceResults(t *testing.T) {
+	makeTestDatabase(t)
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"max_check_attempts": "2"})
+	store := CheckDefinitionFileStore{
+		db:               db,
+		CheckDefinitions: map[string]CheckDefinition{"swap.ini": checkDefinition},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	_, err := ReplaceResults("swap.ini", checkDefinition, parseKamonituOutput("swap.ini", "|0|Port 1\n|1|Port 2|down\n"))
+	assert.NoError(t, err)
+	var softState bool
+	assert.NoError(t, db.Get(&softState, "select soft_state from check_definitions where filename = ?", "swap.ini"))
+	assert.True(t, softState)
+
+	results, err := ReplaceResults("swap.ini", checkDefinition, parseKamonituOutput("swap.ini", "|2|Port 1|down|port1=0|switch|network\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: 2, Name: "Port 1", Text: "down", Perfdata: "port1=0", Host: "switch", Tags: "network", StateType: stateTypeSoft, Attempt: 1, StateHistory: "2"}}, results)
+
+	results, err = ReplaceResults("swap.ini", checkDefinition, parseKamonituOutput("swap.ini", "|2|Port 1|down|port1=0|switch|network\n"))
+	assert.NoError(t, err)
+	assert.True(t, results[0].HardStateChange)
+	assert.NoError(t, db.Get(&softState, "select soft_state from check_definitions where filename = ?", "swap.ini"))
+	assert.False(t, softState)
+
+	// Port 1 without host and Port 2 are no longer reported, Port 1 on switch changes from SOFT to HARD with the same rc
+	stateChanges, err := loadStateChanges("swap.ini", "", time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	changes := []string{}
+	for _, stateChange := range stateChanges {
+		changes = append(changes, fmt.Sprintf("%s@%s %v->%v %s", stateChange.Name, stateChange.Host, stateChange.OldRc, stateChange.NewRc, stateChange.StateType))
+	}
+	assert.Equal(t, []string{
+		"Port 1@ {0 false}->{0 true} HARD",
+		"Port 2@ {0 false}->{1 true} SOFT",
+		"Port 1@switch {0 false}->{2 true} SOFT",
+		"Port 1@ {0 true}->{0 false} HARD",
+		"Port 2@ {1 true}->{0 false} SOFT",
+		"Port 1@switch {2 true}->{2 true} HARD",
+	}, changes)
+	stateChanges, err = loadStateChanges("", "Port 2", time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, stateChanges, 2)
+
+	stored := []Result{}
+	err = db.Select(&stored, "select filename, rc, name, coalesce(text, '') as text, coalesce(perfdata, '') as perfdata, coalesce(host, '') as host, coalesce(tags, '') as tags, state_type, attempt, last_hard_rc, state_history from results where filename = ?", "swap.ini")
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{{Filename: "swap.ini", Rc: 2, Name: "Port 1", Text: "down", Perfdata: "port1=0", Host: "switch", Tags: "network", StateType: stateTypeHard, Attempt: 2, LastHardRc: 2, StateHistory: "2,2"}}, stored)
+}
+
+func TestPruneStateChanges(t *testing.T) {
+	makeTestDatabase(t)
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"max_check_attempts": "1"})
+	store := CheckDefinitionFileStore{
+		db:               db,
+		CheckDefinitions: map[string]CheckDefinition{"swap.ini": checkDefinition},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	// a flapping switch with many ports keeps all its state changes within the retention
+	for i := 0; i < 4; i++ {
+		results := []Result{}
+		for port := 1; port <= 50; port++ {
+			results = append(results, Result{Filename: "swap.ini", Rc: i % 2, Name: fmt.Sprintf("Port %d", port)})
+		}
+		_, err := ReplaceResults("swap.ini", checkDefinition, results)
+		assert.NoError(t, err)
+	}
+	_, err := db.Exec("UPDATE state_changes SET timestamp = ? WHERE id <= 50", time.Now().AddDate(0, 0, -8).Unix())
+	assert.NoError(t, err)
+	stateChanges, err := loadStateChanges("swap.ini", "", time.Now().AddDate(0, 0, -30))
+	assert.NoError(t, err)
+	assert.Len(t, stateChanges, 200)
+
+	assert.NoError(t, pruneStateChanges(7, time.Now()))
+	stateChanges, err = loadStateChanges("swap.ini", "", time.Now().AddDate(0, 0, -30))
+	assert.NoError(t, err)
+	assert.Len(t, stateChanges, 150, "state changes older than the retention are removed")
+}
+
+func TestReplaceResultsConcurrentWriters(t *testing.T) {
+	makeTestDatabase(t)
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"max_check_attempts": "1"})
+	store := CheckDefinitionFileStore{db: db, CheckDefinitions: map[string]CheckDefinition{}}
+	const writers = 4
+	for i := 0; i < writers; i++ {
+		store.CheckDefinitions[fmt.Sprintf("check%d.ini", i)] = checkDefinition
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	// Like the workers of the scheduler, each writer replaces the results of its own check
+	var failed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(filename string) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := ReplaceResults(filename, checkDefinition, []Result{{Filename: filename, Rc: j % 2, Name: "Swap"}})
+				if err != nil {
+					failed.Add(1)
+				}
+			}
+		}(fmt.Sprintf("check%d.ini", i))
+	}
+	wg.Wait()
+	assert.Equal(t, int32(0), failed.Load(), "no result is lost because the database is locked")
+}
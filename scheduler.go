@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	schedulerLagTag = "SchedulerLag"
+)
+
+// Scheduler runs the check definitions of a CheckDefinitionFileStore when they are due.
+// The main loop queues the due checks, MaxParallelChecks workers run them.
+type Scheduler struct {
+	config    *AppConfig
+	store     *CheckDefinitionFileStore
+	startedAt time.Time
+	queue     *checkQueue
+	// reloadRequests are the reasons of requested reloads of the check definitions
+	reloadRequests chan string
+	// abortCtx is cancelled when the shutdown grace period is over, the running checks are killed then
+	abortCtx context.Context
+	abort    context.CancelFunc
+	// notifier reports the state of the main loop to systemd, nil if not notifying
+	notifier *sdNotifier
+
+	lagMu  sync.Mutex
+	maxLag time.Duration // the maximum lag of the checks started since the last main loop run
+}
+
+func makeScheduler(config *AppConfig, store *CheckDefinitionFileStore) *Scheduler {
+	abortCtx, abort := context.WithCancel(context.Background())
+	return &Scheduler{
+		config:         config,
+		store:          store,
+		startedAt:      time.Now(),
+		queue:          makeCheckQueue(),
+		reloadRequests: make(chan string, 1),
+		abortCtx:       abortCtx,
+		abort:          abort,
+	}
+}
+
+// requestReload requests a reload of the check definitions by the main loop. A request while another
+// request is pending is dropped, as the pending reload loads the current state anyway.
+func (s *Scheduler) requestReload(reason string) {
+	select {
+	case s.reloadRequests <- reason:
+	default:
+		slog.Debug("Reload already requested", "reason", reason)
+	}
+}
+
+// firstRunNotBefore returns the earliest time for the first run of a check after the daemon start:
+// DelaySecondsBeforeFirstCheck plus the splay offset of the check. Checks with a schedule run at fixed times and are not spread.
+func (s *Scheduler) firstRunNotBefore(filename string, checkDefinition CheckDefinition) time.Time {
+	delay := time.Duration(checkDefinition.DelaySecondsBeforeFirstCheck) * time.Second
+	if checkDefinition.Schedule != "" {
+		return s.startedAt.Add(delay)
+	}
+	return s.startedAt.Add(delay + splayOffset(filename, checkDefinition.IntervalSecondsBetweenChecks, s.config.SplaySeconds))
+}
+
+// splayOffset deterministically spreads checks by the hash of their filename over splaySeconds,
+// but at most over the interval of the check. So checks with the same interval do not all run at the same instant.
+func splayOffset(filename string, intervalSeconds int, splaySeconds int) time.Duration {
+	spread := min(splaySeconds, intervalSeconds)
+	if spread <= 0 {
+		return 0
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(filename))
+	return time.Duration(hash.Sum32()%uint32(spread)) * time.Second
+}
+
+// Run starts the workers and executes the main loop every IntervalSecondsBetweenMainLoopRuns until ctx is cancelled.
+// Then no further checks are started and the running checks get ShutdownGraceSeconds to finish and store their results,
+// checks still running after that are killed.
+// Requested reloads of the check definitions are applied between main loop runs, so the main loop always sees a consistent store.
+// With a notifier, the status and the watchdog pings are sent to systemd.
+func (s *Scheduler) Run(ctx context.Context) error {
+	interval := time.Duration(s.config.IntervalSecondsBetweenMainLoopRuns) * time.Second
+	slog.Info("Starting scheduler", "interval", interval, "maxParallelChecks", s.config.MaxParallelChecks)
+
+	var workers sync.WaitGroup
+	for i := 0; i < s.config.MaxParallelChecks; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.worker()
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// the watchdog is pinged from this loop, so a hanging main loop is detected by systemd
+	var watchdog <-chan time.Time
+	if s.notifier != nil && s.notifier.watchdog > 0 {
+		watchdogTicker := time.NewTicker(s.notifier.watchdog)
+		defer watchdogTicker.Stop()
+		watchdog = watchdogTicker.C
+	}
+	for {
+		s.runMainLoop()
+		s.notifier.notify("WATCHDOG=1\nSTATUS=" + s.status(time.Now()))
+		for waiting := true; waiting; {
+			select {
+			case <-ctx.Done():
+				s.notifier.notify("STOPPING=1")
+				s.shutdown(&workers)
+				return nil
+			case <-watchdog:
+				s.notifier.notify("WATCHDOG=1")
+			case reason := <-s.reloadRequests:
+				slog.Info("Reload of check definitions requested", "reason", reason)
+				err := s.store.reloadCheckDefinitions(*s.config)
+				if err != nil {
+					slog.Error("Error reloading check definitions", "err", err)
+				}
+				waiting = false
+			case <-ticker.C:
+				waiting = false
+			}
+		}
+	}
+}
+
+// status is the status line of the daemon for systemd.
+func (s *Scheduler) status(lastMainLoop time.Time) string {
+	return fmt.Sprintf("%d Checks, letzter Durchlauf %s", len(s.store.CheckDefinitions), lastMainLoop.Format(time.TimeOnly))
+}
+
+// shutdown drops the queued checks and waits up to ShutdownGraceSeconds for the workers to finish their running checks.
+// Afterwards the remaining checks are aborted and shutdown waits until their process groups are killed.
+func (s *Scheduler) shutdown(workers *sync.WaitGroup) {
+	defer s.abort()
+	grace := time.Duration(s.config.ShutdownGraceSeconds) * time.Second
+	_, pending, running := s.queue.oldestPending()
+	slog.Info("Stopping scheduler - waiting for running checks", "running", running, "dropped", pending, "grace", grace)
+	s.queue.close()
+
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		slog.Info("Scheduler stopped")
+	case <-time.After(grace):
+		_, _, running = s.queue.oldestPending()
+		slog.Warn("Checks still running after shutdown grace period - killing them", "running", running, "grace", grace)
+		s.abort()
+		<-stopped
+		slog.Info("Scheduler stopped after killing running checks")
+	}
+}
+
+// runMainLoop queues all check definitions that are due, whose first run is not delayed and that are
+// within their check period, and reports the scheduler lag and the self monitoring results.
+func (s *Scheduler) runMainLoop() {
+	dueChecks, err := s.store.checkDefinitionsToRun(s.startedAt)
+	if err != nil {
+		slog.Error("Error selecting check definitions to run", "err", err)
+		return
+	}
+	slog.Debug("Check definitions to run", "dueChecks", dueChecks)
+
+	now := time.Now()
+	for _, due := range dueChecks {
+		checkDefinition, ok := s.store.CheckDefinitions[due.Filename]
+		if !ok {
+			slog.Warn("Check definition in database but not loaded from disk", "filename", due.Filename)
+			continue
+		}
+		notBefore := s.firstRunNotBefore(due.Filename, checkDefinition)
+		if now.Before(notBefore) {
+			slog.Debug("Check delayed after start", "filename", due.Filename, "notBefore", notBefore)
+			continue
+		}
+		period := s.store.TimePeriods[checkDefinition.CheckPeriod]
+		if checkDefinition.CheckPeriod != "" && period == nil {
+			// never run a restricted check without its restriction
+			slog.Error("Check period of check definition not defined - skipped", "filename", due.Filename, "checkPeriod", checkDefinition.CheckPeriod)
+			continue
+		}
+		if period != nil && !period.contains(now) {
+			// the check is rescheduled as if it ran, so it is not reported as lagging when the period starts
+			slog.Debug("Check outside of its check period - skipped", "filename", due.Filename, "checkPeriod", period)
+			_ = s.store.updateLastRunTimestamp(due.Filename, now)
+			continue
+		}
+		dueAt := time.Unix(due.DueTimestamp, 0)
+		if dueAt.Before(notBefore) {
+			dueAt = notBefore
+		}
+		if s.queue.push(queuedCheck{filename: due.Filename, checkDefinition: checkDefinition, dueAt: dueAt}) {
+			slog.Debug("Check queued", "filename", due.Filename, "dueAt", dueAt)
+		}
+	}
+
+	s.reportLag()
+	s.monitorSelf(now)
+	_ = pruneStateChanges(s.config.StateChangesRetentionDays, now)
+}
+
+// worker runs queued checks, the most overdue first, until the queue is closed.
+func (s *Scheduler) worker() {
+	for {
+		check, ok := s.queue.pop()
+		if !ok {
+			return
+		}
+		s.recordLag(time.Since(check.dueAt))
+		s.runCheck(check.filename, check.checkDefinition)
+		s.queue.done(check.filename)
+	}
+}
+
+// recordLag remembers the lag of a started check for the next reportLag.
+func (s *Scheduler) recordLag(lag time.Duration) {
+	s.lagMu.Lock()
+	defer s.lagMu.Unlock()
+	s.maxLag = max(s.maxLag, lag)
+}
+
+// reportLag writes the scheduler lag as kamonitu internal result, rated by scheduler_lag_warning_seconds and scheduler_lag_critical_seconds. The lag is the maximum of the lag of the
+// checks started since the last report and the lag of the most overdue check still waiting for a worker.
+func (s *Scheduler) reportLag() {
+	s.lagMu.Lock()
+	lag := s.maxLag
+	s.maxLag = 0
+	s.lagMu.Unlock()
+
+	oldestDueAt, pending, running := s.queue.oldestPending()
+	if !oldestDueAt.IsZero() {
+		lag = max(lag, time.Since(oldestDueAt))
+	}
+
+	t := threshold{int64(s.config.SchedulerLagWarningSeconds), int64(s.config.SchedulerLagCriticalSeconds)}
+	result := Result{Rc: t.rc(int64(lag.Seconds())), Name: "Scheduler Lag"}
+	result.Text = fmt.Sprintf("Scheduler lag %ds, %d checks waiting, %d checks running", int(lag.Seconds()), pending, running)
+	result.Perfdata = fmt.Sprintf("lag=%ds;%d;%d pending=%d running=%d;;;0;%d", int(lag.Seconds()), t.warning, t.critical, pending, running, s.config.MaxParallelChecks)
+	if result.Rc != rcOk {
+		slog.Warn("Scheduler lag", "lag", lag, "pending", pending, "running", running)
+	}
+	err := ReplaceKamonituResultRows([]Result{result}, schedulerLagTag)
+	if err != nil {
+		slog.Error("Error replacing kamonitu results", "err", err)
+	}
+}
+
+// runCheck executes a single check definition, stores the run, its results and resource usage, updates its last_run_timestamp and runs its hooks.
+func (s *Scheduler) runCheck(filename string, checkDefinition CheckDefinition) {
+	err := s.store.updateLastRunTimestamp(filename, time.Now())
+	if err != nil {
+		return
+	}
+
+	execution := executeCheck(s.abortCtx, checkDefinition)
+	if execution.Aborted {
+		// the check is due again right after the restart, its incomplete output is not stored as result.
+		// Checks with a schedule are not run at the restart, but at the next time of their schedule.
+		slog.Warn("Check aborted at shutdown - results not stored", "filename", filename, "duration", execution.Duration)
+		if checkDefinition.Schedule == "" {
+			_ = s.store.updateLastRunTimestamp(filename, time.Unix(0, 0))
+		}
+		return
+	}
+	slog.Info("Check executed", "filename", filename, "rc", execution.ExitCode, "duration", execution.Duration, "timedOut", execution.TimedOut)
+	slog.Debug("Check output", "filename", filename, "stdout", execution.Stdout, "stderr", execution.Stderr)
+	slog.Debug("Check resource usage", "filename", filename, "usage", execution.ResourceUsage)
+	_ = recordResourceUsage(filename, execution.ResourceUsage)
+
+	results := resultsFromExecution(filename, checkDefinition, execution)
+	runId, err := recordCheckRun(makeCheckRun(filename, execution))
+	if err == nil {
+		for i := range results {
+			results[i].RunId = sql.NullInt64{Int64: runId, Valid: true}
+		}
+	}
+	results, err = ReplaceResults(filename, checkDefinition, results)
+	if err != nil {
+		slog.Error("Error replacing results", "filename", filename, "err", err)
+	}
+
+	if execution.TimedOut {
+		_ = recordTimeout(filename, checkDefinition.StopCheckingAfterNumberOfTimeouts)
+	} else {
+		_ = resetTimeouts(filename)
+	}
+
+	runHooks(s.abortCtx, filename, checkDefinition, execution, results)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSplayOffset(t *testing.T) {
+	assert.Equal(t, time.Duration(0), splayOffset("swap.ini", 120, 0))
+	assert.Equal(t, splayOffset("swap.ini", 120, 60), splayOffset("swap.ini", 120, 60), "offset must be deterministic")
+
+	seconds := make(map[time.Duration]bool)
+	for i := 0; i < 200; i++ {
+		offset := splayOffset(fmt.Sprintf("check%d.ini", i), 120, 600)
+		assert.GreaterOrEqual(t, offset, time.Duration(0))
+		assert.Less(t, offset, 120*time.Second, "offset must be within the interval")
+		seconds[offset] = true
+	}
+	assert.Greater(t, len(seconds), 60, "200 checks should be spread over the interval")
+}
+
+func TestFirstRunNotBefore(t *testing.T) {
+	scheduler := makeScheduler(&AppConfig{SplaySeconds: 0}, nil)
+	checkDefinition := makeTestCheckDefinition(t, map[string]string{"delay_seconds_before_first_check": "30"})
+	assert.Equal(t, scheduler.startedAt.Add(30*time.Second), scheduler.firstRunNotBefore("swap.ini", checkDefinition))
+
+	scheduler.config.SplaySeconds = 60
+	assert.Equal(t, scheduler.startedAt.Add(30*time.Second+splayOffset("swap.ini", 120, 60)), scheduler.firstRunNotBefore("swap.ini", checkDefinition))
+}
+
+func TestSchedulerShutdown(t *testing.T) {
+	makeTestDatabase(t)
+	store := &CheckDefinitionFileStore{
+		db: db,
+		CheckDefinitions: map[string]CheckDefinition{
+			"fast.ini": makeTestCheckDefinition(t, map[string]string{"check_command": "sleep 1; echo OK", "delay_seconds_before_first_check": "0"}),
+			"slow.ini": makeTestCheckDefinition(t, map[string]string{"check_command": "sleep 60", "timeout_seconds": "120", "delay_seconds_before_first_check": "0"}),
+			"backup.ini": makeTestCheckDefinition(t, map[string]string{"check_command": "sleep 60", "timeout_seconds": "120", "delay_seconds_before_first_check": "0",
+				"schedule": "0 0 1 1 *"}),
+		},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+	assert.NoError(t, store.updateLastRunTimestamp("backup.ini", time.Now().AddDate(-2, 0, 0)))
+	scheduler := makeScheduler(&AppConfig{IntervalSecondsBetweenMainLoopRuns: 60, MaxParallelChecks: 3, ShutdownGraceSeconds: 2}, store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- scheduler.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		_, _, running := scheduler.queue.oldestPending()
+		return running == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	started := time.Now()
+	cancel()
+	assert.NoError(t, <-stopped)
+	assert.Less(t, time.Since(started), 4*time.Second, "slow.ini must be killed after the grace period")
+	assert.GreaterOrEqual(t, time.Since(started), 2*time.Second)
+
+	results, err := loadResults()
+	assert.NoError(t, err)
+	filenames := []string{}
+	for _, result := range results {
+		filenames = append(filenames, result.Filename)
+	}
+	assert.Contains(t, filenames, "fast.ini", "the check finishing within the grace period stores its results")
+	assert.NotContains(t, filenames, "slow.ini", "the killed check stores no results")
+
+	var lastRun int64
+	assert.NoError(t, db.Get(&lastRun, "select last_run_timestamp from check_definitions where filename = 'slow.ini'"))
+	assert.Equal(t, int64(0), lastRun, "the killed check is due again after the restart")
+	dueChecks, err := store.checkDefinitionsToRun(time.Now())
+	assert.NoError(t, err)
+	for _, due := range dueChecks {
+		assert.NotEqual(t, "backup.ini", due.Filename, "the killed check with a schedule runs at the next time of its schedule")
+	}
+}
+
+func TestRunMainLoopSkipsUnknownCheckPeriod(t *testing.T) {
+	makeTestDatabase(t)
+	store := &CheckDefinitionFileStore{
+		db: db,
+		CheckDefinitions: map[string]CheckDefinition{
+			"backup.ini": makeTestCheckDefinition(t, map[string]string{"check_period": "workhours"}),
+			"swap.ini":   makeTestCheckDefinition(t, map[string]string{}),
+		},
+		TimePeriods: map[string]*TimePeriod{},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	scheduler := makeScheduler(&AppConfig{MaxParallelChecks: 1}, store)
+	scheduler.runMainLoop()
+	_, pending, _ := scheduler.queue.oldestPending()
+	assert.Equal(t, 1, pending, "only swap.ini is queued, backup.ini must not run without its check period")
+}
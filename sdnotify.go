@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotifier sends state changes to systemd with the sd_notify protocol, so kamonitu can run as Type=notify with WatchdogSec.
+// A nil sdNotifier, or one without socket, does nothing.
+type sdNotifier struct {
+	conn *net.UnixConn
+	// watchdog is the interval of the watchdog pings, 0 if the watchdog is not enabled
+	watchdog time.Duration
+}
+
+// makeSdNotifier connects to the datagram socket in $NOTIFY_SOCKET. A name starting with @ is an abstract socket.
+// Without NOTIFY_SOCKET the returned notifier does nothing.
+func makeSdNotifier() (*sdNotifier, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		slog.Debug("NOTIFY_SOCKET not set - not notifying systemd")
+		return &sdNotifier{}, nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return &sdNotifier{}, fmt.Errorf("connecting to NOTIFY_SOCKET %q: %v", os.Getenv("NOTIFY_SOCKET"), err)
+	}
+	notifier := &sdNotifier{conn: conn, watchdog: watchdogInterval()}
+	slog.Info("Notifying systemd", "socket", os.Getenv("NOTIFY_SOCKET"), "watchdog", notifier.watchdog)
+	return notifier, nil
+}
+
+// watchdogInterval returns the interval of the watchdog pings, half of $WATCHDOG_USEC as recommended by sd_watchdog_enabled(3).
+// Returns 0 if the watchdog is not enabled or enabled for another process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// notify sends the state, e.g. READY=1, to systemd. Errors are logged, as they must not stop the daemon.
+func (n *sdNotifier) notify(state string) {
+	if n == nil || n.conn == nil {
+		return
+	}
+	_, err := n.conn.Write([]byte(state))
+	if err != nil {
+		slog.Warn("Error notifying systemd", "state", state, "err", err)
+	}
+}
+
+// close closes the socket.
+func (n *sdNotifier) close() {
+	if n == nil || n.conn == nil {
+		return
+	}
+	n.conn.Close()
+}
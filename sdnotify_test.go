@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSdNotifier(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	notifier, err := makeSdNotifier()
+	assert.NoError(t, err)
+	notifier.notify("READY=1")
+	notifier.close()
+	var nilNotifier *sdNotifier
+	nilNotifier.notify("READY=1")
+
+	socket := t.TempDir() + "/notify.sock"
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "10000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	notifier, err = makeSdNotifier()
+	assert.NoError(t, err)
+	defer notifier.close()
+	assert.Equal(t, 5*time.Second, notifier.watchdog)
+
+	notifier.notify("READY=1\nSTATUS=2 Checks")
+	buffer := make([]byte, 1024)
+	assert.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := listener.Read(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "READY=1\nSTATUS=2 Checks", string(buffer[:n]))
+
+	t.Setenv("WATCHDOG_PID", "1")
+	assert.Equal(t, time.Duration(0), watchdogInterval(), "watchdog of another process")
+	t.Setenv("NOTIFY_SOCKET", t.TempDir()+"/missing.sock")
+	_, err = makeSdNotifier()
+	assert.Error(t, err)
+}
+
+func TestSchedulerNotifiesSystemd(t *testing.T) {
+	makeTestDatabase(t)
+	store := &CheckDefinitionFileStore{db: db, CheckDefinitions: map[string]CheckDefinition{}}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	socket := t.TempDir() + "/notify.sock"
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.NoError(t, err)
+	defer listener.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "200000")
+	t.Setenv("WATCHDOG_PID", "")
+	notifier, err := makeSdNotifier()
+	assert.NoError(t, err)
+	defer notifier.close()
+
+	scheduler := makeScheduler(&AppConfig{IntervalSecondsBetweenMainLoopRuns: 60, MaxParallelChecks: 1}, store)
+	scheduler.notifier = notifier
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- scheduler.Run(ctx)
+	}()
+
+	buffer := make([]byte, 1024)
+	assert.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := listener.Read(buffer)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^WATCHDOG=1\nSTATUS=0 Checks, letzter Durchlauf \d\d:\d\d:\d\d$`, string(buffer[:n]))
+	n, err = listener.Read(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "WATCHDOG=1", string(buffer[:n]), "the watchdog is pinged between main loop runs")
+
+	cancel()
+	assert.NoError(t, <-stopped)
+	n, err = listener.Read(buffer)
+	assert.NoError(t, err)
+	for string(buffer[:n]) == "WATCHDOG=1" {
+		n, err = listener.Read(buffer)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, "STOPPING=1", string(buffer[:n]))
+}
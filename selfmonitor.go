@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// selfMonitoringTag is the tag of the kamonitu internal results about the state of the daemon itself
+const selfMonitoringTag = "SelfMonitoring"
+
+// threshold are the warning and critical thresholds of a self monitoring value.
+type threshold struct {
+	warning  int64
+	critical int64
+}
+
+// rc returns the rc of a value, that is a problem when it reaches the thresholds.
+func (t threshold) rc(value int64) int {
+	switch {
+	case value >= t.critical:
+		return rcCritical
+	case value >= t.warning:
+		return rcWarning
+	}
+	return rcOk
+}
+
+// rcBelow returns the rc of a value, that is a problem when it falls below the thresholds.
+func (t threshold) rcBelow(value int64) int {
+	switch {
+	case value < t.critical:
+		return rcCritical
+	case value < t.warning:
+		return rcWarning
+	}
+	return rcOk
+}
+
+// validateSelfMonitoringThresholds checks that the warning thresholds are reached before the critical thresholds.
+func validateSelfMonitoringThresholds(config *AppConfig) error {
+	pairs := []struct {
+		warning, critical           string
+		warningValue, criticalValue int
+	}{
+		{"SchedulerLagWarningSeconds", "SchedulerLagCriticalSeconds", config.SchedulerLagWarningSeconds, config.SchedulerLagCriticalSeconds},
+		{"SuspendedChecksWarning", "SuspendedChecksCritical", config.SuspendedChecksWarning, config.SuspendedChecksCritical},
+		{"DbSizeWarningMb", "DbSizeCriticalMb", config.DbSizeWarningMb, config.DbSizeCriticalMb},
+		{"WalSizeWarningMb", "WalSizeCriticalMb", config.WalSizeWarningMb, config.WalSizeCriticalMb},
+		{"ReloadFailedWarningSeconds", "ReloadFailedCriticalSeconds", config.ReloadFailedWarningSeconds, config.ReloadFailedCriticalSeconds},
+	}
+	for _, pair := range pairs {
+		if pair.warningValue > pair.criticalValue {
+			return fmt.Errorf("field %s %v darf nicht größer als %s %v sein", pair.warning, pair.warningValue, pair.critical, pair.criticalValue)
+		}
+	}
+	if config.LogDirFreeWarningPercent < config.LogDirFreeCriticalPercent {
+		return fmt.Errorf("field LogDirFreeWarningPercent %v darf nicht kleiner als LogDirFreeCriticalPercent %v sein", config.LogDirFreeWarningPercent, config.LogDirFreeCriticalPercent)
+	}
+	return nil
+}
+
+// monitorSelf writes the self monitoring results of the daemon as kamonitu internal results:
+// suspended checks, size of the database and its WAL, reload of the check definitions and free space in the log directory.
+// The scheduler lag is reported by reportLag.
+func (s *Scheduler) monitorSelf(now time.Time) {
+	results := []Result{
+		suspendedChecksResult(threshold{int64(s.config.SuspendedChecksWarning), int64(s.config.SuspendedChecksCritical)}),
+		fileSizeResult("Database Size", "db", s.config.DbFile(), threshold{int64(s.config.DbSizeWarningMb), int64(s.config.DbSizeCriticalMb)}),
+		fileSizeResult("WAL Size", "wal", s.config.DbFile()+"-wal", threshold{int64(s.config.WalSizeWarningMb), int64(s.config.WalSizeCriticalMb)}),
+		s.store.reloadResult(now, threshold{int64(s.config.ReloadFailedWarningSeconds), int64(s.config.ReloadFailedCriticalSeconds)}),
+		freeSpaceResult("Log Dir Free Space", s.config.LogDir, threshold{int64(s.config.LogDirFreeWarningPercent), int64(s.config.LogDirFreeCriticalPercent)}),
+	}
+	for _, result := range results {
+		if result.Rc != rcOk {
+			slog.Warn("Self monitoring problem", "name", result.Name, "rc", result.Rc, "text", result.Text)
+		}
+	}
+	err := ReplaceKamonituResultRows(results, selfMonitoringTag)
+	if err != nil {
+		slog.Error("Error replacing kamonitu results", "err", err)
+	}
+}
+
+// suspendedChecksResult reports the checks suspended after too many timeouts.
+func suspendedChecksResult(t threshold) Result {
+	result := Result{Rc: rcOk, Name: "Suspended Checks"}
+	filenames := []string{}
+	err := db.Select(&filenames, "select filename from check_definitions where suspended = 1 order by filename")
+	if err != nil {
+		slog.Error("Error selecting suspended checks", "err", err)
+		result.Rc = rcUnknown
+		result.Text = fmt.Sprintf("Suspended checks could not be selected: %v", err)
+		return result
+	}
+	result.Rc = t.rc(int64(len(filenames)))
+	result.Text = fmt.Sprintf("%d checks suspended", len(filenames))
+	if len(filenames) > 0 {
+		result.Text += ": " + strings.Join(filenames, ", ")
+	}
+	result.Perfdata = fmt.Sprintf("suspended=%d;%d;%d;0", len(filenames), t.warning, t.critical)
+	return result
+}
+
+// fileSizeResult reports the size of a file in MB. A missing file has size 0, e.g. the WAL after a checkpoint.
+func fileSizeResult(name string, label string, path string, t threshold) Result {
+	result := Result{Rc: rcOk, Name: name}
+	var size int64
+	info, err := os.Stat(path)
+	if err == nil {
+		size = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		result.Rc = rcUnknown
+		result.Text = fmt.Sprintf("Size of %s could not be determined: %v", path, err)
+		return result
+	}
+	sizeMb := size / (1024 * 1024)
+	result.Rc = t.rc(sizeMb)
+	result.Text = fmt.Sprintf("%s is %d MB", path, sizeMb)
+	result.Perfdata = fmt.Sprintf("%s=%dB;%d;%d;0", label, size, t.warning*1024*1024, t.critical*1024*1024)
+	return result
+}
+
+// reloadResult reports since when the check definitions fail to load. Loads without errors are OK.
+func (c *CheckDefinitionFileStore) reloadResult(now time.Time, t threshold) Result {
+	result := Result{Rc: rcOk, Name: "Check Definitions Reload"}
+	lastSuccess := "never"
+	if !c.lastSuccessfulLoad.IsZero() {
+		lastSuccess = c.lastSuccessfulLoad.Format(time.DateTime)
+	}
+	if c.failingSince.IsZero() {
+		result.Text = fmt.Sprintf("Check definitions loaded without errors at %s", lastSuccess)
+		result.Perfdata = fmt.Sprintf("failing=0s;%d;%d;0", t.warning, t.critical)
+		return result
+	}
+	failing := int64(now.Sub(c.failingSince).Seconds())
+	result.Rc = t.rc(failing)
+	result.Text = fmt.Sprintf("Check definitions fail to load since %s, last load without errors: %s", c.failingSince.Format(time.DateTime), lastSuccess)
+	result.Perfdata = fmt.Sprintf("failing=%ds;%d;%d;0", failing, t.warning, t.critical)
+	return result
+}
+
+// freeSpaceResult reports the free space in percent of the filesystem of a directory.
+func freeSpaceResult(name string, directory string, t threshold) Result {
+	result := Result{Rc: rcOk, Name: name}
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(directory, &stat)
+	if err != nil || stat.Blocks == 0 {
+		result.Rc = rcUnknown
+		result.Text = fmt.Sprintf("Free space of %s could not be determined: %v", directory, err)
+		return result
+	}
+	freePercent := int64(stat.Bavail * 100 / stat.Blocks)
+	freeMb := int64(stat.Bavail) * stat.Bsize / (1024 * 1024)
+	result.Rc = t.rcBelow(freePercent)
+	result.Text = fmt.Sprintf("%d%% (%d MB) free in %s", freePercent, freeMb, directory)
+	result.Perfdata = fmt.Sprintf("free=%d%%;%d:;%d:;0;100", freePercent, t.warning, t.critical)
+	return result
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestThreshold(t *testing.T) {
+	th := threshold{warning: 10, critical: 20}
+	assert.Equal(t, rcOk, th.rc(9))
+	assert.Equal(t, rcWarning, th.rc(10))
+	assert.Equal(t, rcCritical, th.rc(20))
+	free := threshold{warning: 10, critical: 5}
+	assert.Equal(t, rcOk, free.rcBelow(10))
+	assert.Equal(t, rcWarning, free.rcBelow(9))
+	assert.Equal(t, rcCritical, free.rcBelow(4))
+}
+
+func TestValidateSelfMonitoringThresholds(t *testing.T) {
+	config, err := ParseStringMapToStruct(appConfigDefaultMap, AppConfig{})
+	assert.NoError(t, err)
+	assert.NoError(t, validateSelfMonitoringThresholds(config))
+
+	config.WalSizeWarningMb = config.WalSizeCriticalMb + 1
+	assert.ErrorContains(t, validateSelfMonitoringThresholds(config), "WalSizeWarningMb")
+	config.WalSizeWarningMb = config.WalSizeCriticalMb
+	config.LogDirFreeWarningPercent = 1
+	assert.ErrorContains(t, validateSelfMonitoringThresholds(config), "LogDirFreeWarningPercent")
+}
+
+func TestSelfMonitoringResults(t *testing.T) {
+	dbFile := makeTestDatabase(t)
+	store := CheckDefinitionFileStore{
+		db: db,
+		CheckDefinitions: map[string]CheckDefinition{
+			"swap.ini": makeTestCheckDefinition(t, map[string]string{}),
+			"cpu.ini":  makeTestCheckDefinition(t, map[string]string{}),
+		},
+	}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+
+	result := suspendedChecksResult(threshold{1, 2})
+	assert.Equal(t, rcOk, result.Rc)
+	_, err := db.Exec("update check_definitions set suspended = 1 where filename = 'swap.ini'")
+	assert.NoError(t, err)
+	result = suspendedChecksResult(threshold{1, 2})
+	assert.Equal(t, rcWarning, result.Rc)
+	assert.Equal(t, "1 checks suspended: swap.ini", result.Text)
+	assert.Equal(t, "suspended=1;1;2;0", result.Perfdata)
+
+	result = fileSizeResult("Database Size", "db", dbFile, threshold{1, 2})
+	assert.Equal(t, rcOk, result.Rc)
+	assert.Regexp(t, `^db=\d+B;1048576;2097152;0$`, result.Perfdata)
+	result = fileSizeResult("WAL Size", "wal", dbFile+"-missing", threshold{0, 2})
+	assert.Equal(t, rcWarning, result.Rc, "a missing file has size 0")
+
+	result = freeSpaceResult("Log Dir Free Space", t.TempDir(), threshold{0, 0})
+	assert.Equal(t, rcOk, result.Rc)
+	result = freeSpaceResult("Log Dir Free Space", t.TempDir(), threshold{101, 101})
+	assert.Equal(t, rcCritical, result.Rc)
+	result = freeSpaceResult("Log Dir Free Space", "/nonexistent", threshold{10, 5})
+	assert.Equal(t, rcUnknown, result.Rc)
+
+	now := time.Now()
+	store.recordLoad(true, now.Add(-time.Hour))
+	assert.Equal(t, rcOk, store.reloadResult(now, threshold{0, 600}).Rc)
+	store.recordLoad(false, now.Add(-time.Minute))
+	store.recordLoad(false, now)
+	result = store.reloadResult(now, threshold{0, 600})
+	assert.Equal(t, rcWarning, result.Rc)
+	assert.Contains(t, result.Perfdata, "failing=60s;")
+	assert.Equal(t, rcCritical, store.reloadResult(now.Add(10*time.Minute), threshold{0, 600}).Rc)
+	store.recordLoad(true, now)
+	assert.Equal(t, rcOk, store.reloadResult(now, threshold{0, 600}).Rc)
+}
+
+func TestMonitorSelf(t *testing.T) {
+	dbFile := makeTestDatabase(t)
+	config, err := ParseStringMapToStruct(appConfigDefaultMap, AppConfig{})
+	assert.NoError(t, err)
+	config.VarDir = dbFile[:len(dbFile)-len("/kamonitu.db")]
+	config.LogDir = os.TempDir()
+	store := &CheckDefinitionFileStore{db: db, CheckDefinitions: map[string]CheckDefinition{}}
+	assert.NoError(t, store.ensureCheckDefinitionsInDatabase())
+	store.recordLoad(true, time.Now())
+
+	makeScheduler(config, store).monitorSelf(time.Now())
+	results, err := loadResults()
+	assert.NoError(t, err)
+	names := []string{}
+	for _, result := range results {
+		if result.Filename == kamonituInternalFilename && result.Tags == selfMonitoringTag {
+			assert.Equal(t, rcOk, result.Rc, result.Text)
+			names = append(names, result.Name)
+		}
+	}
+	assert.ElementsMatch(t, []string{"Suspended Checks", "Database Size", "WAL Size", "Check Definitions Reload", "Log Dir Free Space"}, names)
+}
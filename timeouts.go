@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// suspendedCheckTag is the tag of the kamonitu internal result that reports a suspended check.
+func suspendedCheckTag(filename string) string {
+	return "Suspended " + filename
+}
+
+// recordTimeout increments the consecutive timeouts of the check definition. If the number of consecutive
+// timeouts reaches stopCheckingAfterNumberOfTimeouts, the check gets suspended and a kamonitu internal
+// warning is written. A suspended check is not run until it is resumed with 'kamonitu resume-check'.
+func recordTimeout(filename string, stopCheckingAfterNumberOfTimeouts int) error {
+	var consecutiveTimeouts int
+	var suspended bool
+	err := db.QueryRow("update check_definitions set consecutive_timeouts = consecutive_timeouts + 1, suspended = (consecutive_timeouts + 1 >= ?) where filename = ? returning consecutive_timeouts, suspended",
+		stopCheckingAfterNumberOfTimeouts, filename).Scan(&consecutiveTimeouts, &suspended)
+	if err != nil {
+		slog.Error("Error incrementing consecutive timeouts", "filename", filename, "err", err)
+		return err
+	}
+	slog.Warn("Check timed out", "filename", filename, "consecutiveTimeouts", consecutiveTimeouts, "stopCheckingAfterNumberOfTimeouts", stopCheckingAfterNumberOfTimeouts)
+	if !suspended {
+		return nil
+	}
+
+	slog.Warn("Check suspended", "filename", filename, "consecutiveTimeouts", consecutiveTimeouts)
+	message := fmt.Sprintf("Check %s suspended after %d consecutive timeouts - resume with 'kamonitu resume-check %s'", filename, consecutiveTimeouts, filename)
+	return ReplaceKamonituResults([]string{message}, suspendedCheckTag(filename))
+}
+
+// resetTimeouts resets the consecutive timeouts of the check definition after a run without timeout.
+func resetTimeouts(filename string) error {
+	_, err := db.Exec("update check_definitions set consecutive_timeouts = 0 where filename = ? and consecutive_timeouts != 0", filename)
+	if err != nil {
+		slog.Error("Error resetting consecutive timeouts", "filename", filename, "err", err)
+	}
+	return err
+}
+
+// resumeCheck resets the consecutive timeouts of a suspended check definition and removes the kamonitu internal warning.
+func resumeCheck(filename string) error {
+	res, err := db.Exec("update check_definitions set consecutive_timeouts = 0, suspended = 0 where filename = ? and filename != ?", filename, kamonituInternalFilename)
+	if err != nil {
+		slog.Error("Error resuming check", "filename", filename, "err", err)
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("check definition %q nicht in der Datenbank gefunden", filename)
+	}
+	slog.Info("Check resumed", "filename", filename)
+	return ReplaceKamonituResults(nil, suspendedCheckTag(filename))
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timePeriodsFileName = "timeperiods.ini"
+
+const minutesPerDay = 24 * 60
+
+// TimePeriod is a named period of the week, e.g. "workhours = mon-fri 08:00-18:00 Europe/Berlin",
+// defined in the file timeperiods.ini. Check definitions bound to a period via check_period only run within it.
+type TimePeriod struct {
+	Name       string
+	Definition string
+	location   *time.Location
+	rules      []timePeriodRule
+}
+
+// timePeriodRule are time ranges on some days of the week, e.g. "mon-fri 08:00-12:00,13:00-18:00".
+type timePeriodRule struct {
+	weekdays [7]bool
+	ranges   []minuteRange
+}
+
+// minuteRange is a time range in minutes of the day. If to is before from, the range ends on the next day.
+type minuteRange struct {
+	from, to int
+}
+
+// LoadTimePeriods loads the time periods from the file timeperiods.ini. A missing file defines no time periods.
+func (c *CheckDefinitionFileStore) LoadTimePeriods(timePeriodsFile string) error {
+	c.TimePeriods = make(map[string]*TimePeriod)
+	slog.Info("Loading time periods from disk.", "timePeriodsFile", timePeriodsFile)
+	_, err := os.Stat(timePeriodsFile)
+	if err != nil {
+		slog.Info("Time periods file not found.", "file", timePeriodsFile)
+		return nil
+	}
+
+	iniFileMap, err := readIniFile(timePeriodsFile)
+	if err != nil {
+		slog.Error("Time periods file could not be read.", "file", timePeriodsFile)
+		return err
+	}
+	for name, definition := range iniFileMap {
+		period, err := parseTimePeriod(name, definition)
+		if err != nil {
+			return fmt.Errorf("time period in %q: %v", timePeriodsFile, err)
+		}
+		c.TimePeriods[name] = period
+	}
+	slog.Info("Parsed time periods.", "path", timePeriodsFile, "timePeriods", iniFileMap)
+	return nil
+}
+
+// parseTimePeriod parses the definition of a time period: rules separated by ";" and an optional time zone at the end,
+// e.g. "mon-fri 08:00-12:00,13:00-18:00; sat 09:00-12:00 Europe/Berlin". Without a time zone the local time is used.
+func parseTimePeriod(name string, definition string) (*TimePeriod, error) {
+	period := &TimePeriod{Name: name, Definition: definition, location: time.Local}
+
+	ruleDefinitions := strings.Split(definition, ";")
+	last := strings.Fields(ruleDefinitions[len(ruleDefinitions)-1])
+	if len(last) == 3 {
+		location, err := time.LoadLocation(last[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s: ungültige Zeitzone %q", name, last[2])
+		}
+		period.location = location
+		ruleDefinitions[len(ruleDefinitions)-1] = strings.Join(last[:2], " ")
+	}
+
+	for _, ruleDefinition := range ruleDefinitions {
+		fields := strings.Fields(ruleDefinition)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: %q muss das Format '<Tage> <Zeiten>' haben, z.B. 'mon-fri 08:00-18:00'", name, strings.TrimSpace(ruleDefinition))
+		}
+		rule := timePeriodRule{}
+		err := parseTimePeriodWeekdays(fields[0], &rule.weekdays)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, rangeDefinition := range strings.Split(fields[1], ",") {
+			r, err := parseMinuteRange(rangeDefinition)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			rule.ranges = append(rule.ranges, r)
+		}
+		period.rules = append(period.rules, rule)
+	}
+	return period, nil
+}
+
+// parseTimePeriodWeekdays parses a comma separated list of weekdays and ranges of weekdays, e.g. "mon-fri,sun", or "*" for all days.
+func parseTimePeriodWeekdays(definition string, weekdays *[7]bool) error {
+	if definition == "*" {
+		definition = "sun-sat"
+	}
+	for _, part := range strings.Split(definition, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		first, err := parseCronValue(from, cronFields[4])
+		if err != nil {
+			return err
+		}
+		last, err := parseCronValue(to, cronFields[4])
+		if err != nil {
+			return err
+		}
+		// sat-sun wraps around the end of the week
+		for day := first; ; day++ {
+			weekdays[day%7] = true
+			if day%7 == last%7 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseMinuteRange parses a time range like "08:00-18:00". The end may be 24:00.
+func parseMinuteRange(definition string) (minuteRange, error) {
+	from, to, ok := strings.Cut(definition, "-")
+	if !ok {
+		return minuteRange{}, fmt.Errorf("ungültiger Zeitbereich %q, erwartet z.B. 08:00-18:00", definition)
+	}
+	fromMinute, err := parseMinuteOfDay(from)
+	if err != nil {
+		return minuteRange{}, err
+	}
+	toMinute, err := parseMinuteOfDay(to)
+	if err != nil {
+		return minuteRange{}, err
+	}
+	if fromMinute == toMinute || fromMinute == minutesPerDay {
+		return minuteRange{}, fmt.Errorf("ungültiger Zeitbereich %q", definition)
+	}
+	return minuteRange{from: fromMinute, to: toMinute}, nil
+}
+
+// parseMinuteOfDay parses a time of the day "HH:MM" into minutes since midnight.
+func parseMinuteOfDay(value string) (int, error) {
+	hour, minute, ok := strings.Cut(value, ":")
+	h, err1 := strconv.Atoi(hour)
+	m, err2 := strconv.Atoi(minute)
+	if !ok || err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h*60+m > minutesPerDay {
+		return 0, fmt.Errorf("ungültige Uhrzeit %q, erwartet HH:MM", value)
+	}
+	return h*60 + m, nil
+}
+
+// contains returns true, if t is within the time period.
+func (p *TimePeriod) contains(t time.Time) bool {
+	t = t.In(p.location)
+	minute := t.Hour()*60 + t.Minute()
+	today := int(t.Weekday())
+	yesterday := (today + 6) % 7
+	for _, rule := range p.rules {
+		for _, r := range rule.ranges {
+			if r.from < r.to {
+				if rule.weekdays[today] && minute >= r.from && minute < r.to {
+					return true
+				}
+				continue
+			}
+			// the range ends on the next day
+			if rule.weekdays[today] && minute >= r.from {
+				return true
+			}
+			if rule.weekdays[yesterday] && minute < r.to {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns the name and the definition of the time period, e.g. for show-config.
+func (p *TimePeriod) String() string {
+	return p.Name + " (" + p.Definition + ")"
+}
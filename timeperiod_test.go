@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseTimePeriod(t *testing.T) {
+	valid := []string{"mon-fri 08:00-18:00", "mon-fri 08:00-12:00,13:00-18:00; sat 09:00-12:00 Europe/Berlin", "* 00:00-24:00 UTC", "sat-sun 22:00-06:00"}
+	for _, definition := range valid {
+		_, err := parseTimePeriod("test", definition)
+		assert.NoError(t, err, definition)
+	}
+	invalid := []string{"", "mon-fri", "mon-fri 08:00", "mon-fri 08:00-18:00 Mars/Olympus", "xyz 08:00-18:00", "mon 08:00-08:00", "mon 25:00-26:00", "mon 08:61-09:00"}
+	for _, definition := range invalid {
+		_, err := parseTimePeriod("test", definition)
+		assert.Error(t, err, definition)
+	}
+}
+
+func TestTimePeriodContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	at := func(value string) time.Time {
+		ts, err := time.ParseInLocation(time.DateTime, value, berlin)
+		assert.NoError(t, err)
+		return ts
+	}
+	workhours, err := parseTimePeriod("workhours", "mon-fri 08:00-12:00,13:00-18:00; sat 09:00-12:00 Europe/Berlin")
+	assert.NoError(t, err)
+	nights, err := parseTimePeriod("nights", "fri 22:00-06:00 Europe/Berlin")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		period *TimePeriod
+		at     time.Time
+		want   bool
+	}{
+		{"monday morning", workhours, at("2025-02-10 08:00:00"), true},
+		{"monday lunch", workhours, at("2025-02-10 12:30:00"), false},
+		{"monday evening", workhours, at("2025-02-10 18:00:00"), false},
+		{"saturday", workhours, at("2025-02-15 11:59:00"), true},
+		{"sunday", workhours, at("2025-02-16 10:00:00"), false},
+		{"other time zone", workhours, at("2025-02-10 08:30:00").In(time.UTC), true},
+		{"friday night", nights, at("2025-02-14 23:00:00"), true},
+		{"saturday morning", nights, at("2025-02-15 05:59:00"), true},
+		{"saturday night", nights, at("2025-02-15 23:00:00"), false},
+		{"friday morning", nights, at("2025-02-14 05:00:00"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.period.contains(tt.at))
+		})
+	}
+}
+
+func TestCheckPeriodOfCheckDefinitions(t *testing.T) {
+	d := t.TempDir()
+	checkdir := d + "/check_definitions"
+	assert.NoError(t, os.Mkdir(checkdir, 0755))
+	assert.NoError(t, os.WriteFile(d+"/"+timePeriodsFileName, []byte("workhours = mon-fri 08:00-18:00\n"), 0644))
+	assert.NoError(t, os.WriteFile(checkdir+"/printer.ini", []byte("check_command = true\ncheck_period = workhours\n"), 0644))
+
+	store, err := makeCheckDefinitionFileStore(AppConfig{CheckDefinitionsDir: checkdir, ConfigDir: d})
+	assert.NoError(t, err)
+	assert.NoError(t, store.LoadCheckDefinitionsFromDisk())
+	assert.Equal(t, "workhours", store.CheckDefinitions["printer.ini"].CheckPeriod)
+
+	assert.NoError(t, os.WriteFile(checkdir+"/printer.ini", []byte("check_command = true\ncheck_period = weekend\n"), 0644))
+	assert.Error(t, store.LoadCheckDefinitionsFromDisk(), "undefined check period")
+}
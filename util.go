@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // sort2DSlice sorts a 2D slice of strings lexicographically based on the first element of each inner slice.
@@ -84,7 +86,7 @@ func printSimpleTable(header []string, content [][]string) {
 }
 
 // structToMap converts a struct to a map with keys as snake_case field names and values as string representations of the fields.
-// Returns the map and a slice of ordered field names in the same snake_case format.
+// Returns the map and a slice of ordered field names in the same snake_case format. Fields without "db" tag or with "db" tag "-" are skipped.
 func structToMap(s interface{}) (result map[string]string, orderedFieldName []string) {
 	result = make(map[string]string)
 
@@ -98,19 +100,16 @@ func structToMap(s interface{}) (result map[string]string, orderedFieldName []st
 	for _, fieldName := range fieldNames {
 		field, _ := typ.FieldByName(fieldName)
 		ini_key := field.Tag.Get("db")
-		if ini_key == "" {
+		if ini_key == "" || ini_key == "-" {
 			continue
 		}
 		iniMapFieldName := camelCaseToSnakeCase(fieldName)
 		fieldValue := val.FieldByName(field.Name)
 		// Convert field value to string
 		result[iniMapFieldName] = fmt.Sprintf("%v", fieldValue.Interface())
+		orderedFieldName = append(orderedFieldName, iniMapFieldName)
 	}
 
-	orderedFieldName = make([]string, len(fieldNames))
-	for i, v := range fieldNames {
-		orderedFieldName[i] = camelCaseToSnakeCase(v)
-	}
 	return result, orderedFieldName
 }
 
@@ -195,3 +194,25 @@ func getStructTags(input interface{}, tags []string) map[string]map[string]strin
 
 	return result
 }
+
+// parseDuration parses a duration like time.ParseDuration, but additionally supports days, e.g. "7d".
+func parseDuration(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseTime parses a point in time given on the command line in local time, e.g. "2025-01-30 14:00".
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04", time.DateOnly, time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected e.g. \"2025-01-30 14:00\"", s)
+}
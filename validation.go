@@ -19,7 +19,7 @@ const (
 var validationRegexCacheMap map[string]*regexp.Regexp
 
 // ValidateStruct Verwendet Struct Tag "validation"
-// - strings: readableDirectory, writeableDirectory
+// - strings: readableDirectory, writeableDirectory, oneOf(a,b,...), cronExpression, existingDirectory (empty is allowed)
 // - int: within(lower, upper)
 func ValidateStruct(input any) error {
 
@@ -96,6 +96,22 @@ func ValidateStruct(input any) error {
 				if err != nil {
 					return fmt.Errorf("field %v must be a writable directory, but the temporary file in %v could not be removed", field.Name, v)
 				}
+			} else if validationRules == "existingDirectory" {
+				if v == "" {
+					continue
+				}
+				info, err := os.Stat(v)
+				if err != nil || !info.IsDir() {
+					return fmt.Errorf("field %v must be an existing directory, but %v is not accessible or does not exist", field.Name, v)
+				}
+			} else if validationRules == "cronExpression" {
+				if v == "" {
+					continue
+				}
+				_, err := parseCronExpression(v)
+				if err != nil {
+					return fmt.Errorf("field %v must be a cron expression: %v", field.Name, err)
+				}
 			} else if strings.HasPrefix(validationRules, "oneOf(") && strings.HasSuffix(validationRules, ")") {
 				values := strings.Split(validationRules[6:len(validationRules)-1], ",")
 				if !slices.Contains(values, v) {
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// watcherSettleTime is the time the watcher waits for further changes, e.g. of an editor saving a file,
+	// before it requests a reload
+	watcherSettleTime = time.Second
+	watcherEvents     = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+)
+
+// configWatcher watches the check definitions directory and the config files of the check definitions with inotify.
+type configWatcher struct {
+	file *os.File
+	// directories by watch descriptor
+	directories map[int32]string
+	// relevant returns true for a file in a watched directory, that is relevant for the check definitions
+	relevant func(directory string, name string) bool
+}
+
+// makeConfigWatcher watches the check definitions in CheckDefinitionsDir, check_defaults.ini and timeperiods.ini.
+func makeConfigWatcher(config *AppConfig) (*configWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %v", err)
+	}
+	// a non blocking file is read via the runtime poller, so close interrupts a pending read
+	watcher := &configWatcher{
+		file:        os.NewFile(uintptr(fd), "inotify"),
+		directories: make(map[int32]string),
+	}
+	checkDefinitionsDir := filepath.Clean(config.CheckDefinitionsDir)
+	configDir := filepath.Clean(config.ConfigDir)
+	watcher.relevant = func(directory string, name string) bool {
+		if directory == checkDefinitionsDir && isIniFile(name) {
+			return true
+		}
+		return directory == configDir && (name == checkDefinitionDefaultsFileName || name == timePeriodsFileName)
+	}
+
+	for _, directory := range []string{checkDefinitionsDir, configDir} {
+		wd, err := syscall.InotifyAddWatch(fd, directory, watcherEvents)
+		if err != nil {
+			watcher.file.Close()
+			return nil, fmt.Errorf("inotify watch %q: %v", directory, err)
+		}
+		watcher.directories[int32(wd)] = directory
+	}
+	return watcher, nil
+}
+
+// run reads the inotify events until ctx is cancelled and calls reload, when relevant files changed
+// and no further change happened for watcherSettleTime.
+func (w *configWatcher) run(ctx context.Context, reload func(reason string)) {
+	changes := make(chan string, 1)
+	go func() {
+		<-ctx.Done()
+		w.file.Close()
+	}()
+	go w.readEvents(changes)
+
+	var settle <-chan time.Time
+	changed := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case name, ok := <-changes:
+			if !ok {
+				return
+			}
+			changed = name
+			settle = time.After(watcherSettleTime)
+		case <-settle:
+			settle = nil
+			reload("changed " + changed)
+		}
+	}
+}
+
+// readEvents sends the names of changed relevant files to changes until the inotify file is closed.
+func (w *configWatcher) readEvents(changes chan<- string) {
+	defer close(changes)
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buffer)
+		if err != nil {
+			slog.Debug("Stopped reading inotify events", "err", err)
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameBytes := buffer[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			directory := w.directories[event.Wd]
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 || w.relevant(directory, name) {
+				slog.Debug("Config file changed", "directory", directory, "name", name, "mask", event.Mask)
+				select {
+				case changes <- filepath.Join(directory, name):
+				default:
+				}
+			}
+		}
+	}
+}